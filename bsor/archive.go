@@ -0,0 +1,247 @@
+package bsor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var ErrNotArchive = Error{"not a BSOR archive"}
+var ErrUnknownArchiveVersion = Error{"unknown BSOR archive version"}
+var ErrInvalidArchive = Error{"invalid BSOR archive"}
+
+var archiveMagic = []byte("BSRA")
+
+const archiveVersion = 1
+
+// every frame is encoded as this number of 32-bit words: time, fps and 21 floats of positions and rotations
+const frameWords = frameSize / 4
+
+// Archive writes the replay in a compact archival format. Frames are stored column by column,
+// every value as the difference of its bits from the previous frame, which is small for smooth
+// movements, then everything is compressed with zstd. The archive is lossless, Write of
+// the unarchived replay gives the same bytes as Write of the original one.
+func Archive(writer io.Writer, replay *Replay) error {
+	var payload bytes.Buffer
+
+	// everything but frames is stored as BSOR, it's a small part of the replay
+	withoutFrames := *replay
+	withoutFrames.Frames = nil
+
+	var bsor bytes.Buffer
+	if err := Write(&bsor, &withoutFrames); err != nil {
+		return err
+	}
+
+	writeUvarint(&payload, uint64(bsor.Len()))
+	payload.Write(bsor.Bytes())
+
+	writeUvarint(&payload, uint64(len(replay.Frames)))
+	// every column is stored as 4 planes of bytes of the deltas, from the most significant one,
+	// small deltas leave the first planes almost empty and these compress really well
+	n := len(replay.Frames)
+	planes := make([]byte, 4*n)
+	for column := 0; column < frameWords; column++ {
+		var previous uint32
+		for i := range replay.Frames {
+			word := frameWord(&replay.Frames[i], column)
+			delta := zigzag(int32(word - previous))
+			planes[i], planes[n+i], planes[2*n+i], planes[3*n+i] = byte(delta>>24), byte(delta>>16), byte(delta>>8), byte(delta)
+			previous = word
+		}
+
+		payload.Write(planes)
+	}
+
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+	if err != nil {
+		return err
+	}
+
+	if _, err = writer.Write(append(append([]byte{}, archiveMagic...), archiveVersion)); err != nil {
+		return err
+	}
+
+	_, err = writer.Write(encoder.EncodeAll(payload.Bytes(), nil))
+
+	return err
+}
+
+// Unarchive reads the replay written by Archive. Limits given by WithLimits, DefaultLimits otherwise,
+// apply to the unarchived replay as if it was read by Read, other options are ignored.
+func Unarchive(reader io.Reader, options ...ReadOption) (*Replay, error) {
+	limits := newReadOptions(options).limits
+
+	header := make([]byte, len(archiveMagic)+1)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrNotArchive
+		}
+
+		return nil, err
+	}
+
+	if !bytes.Equal(header[:len(archiveMagic)], archiveMagic) {
+		return nil, ErrNotArchive
+	}
+
+	if header[len(archiveMagic)] != archiveVersion {
+		return nil, ErrUnknownArchiveVersion
+	}
+
+	decoder, err := zstd.NewReader(reader, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+
+	defer decoder.Close()
+
+	decompressed := io.Reader(decoder)
+	if limits.MaxTotalBytes > 0 {
+		// besides the replay, the payload holds only its length and the frames count
+		decompressed = io.LimitReader(decoder, limits.MaxTotalBytes+2*binary.MaxVarintLen64)
+	}
+
+	payload := bufio.NewReader(decompressed)
+
+	bsorLength, err := binary.ReadUvarint(payload)
+	if err != nil {
+		return nil, archiveError(err)
+	}
+
+	if err = checkArchiveBytes(&limits, bsorLength); err != nil {
+		return nil, err
+	}
+
+	// length is not trusted either, buffer grows only as the data actually arrives
+	var bsor bytes.Buffer
+	if read, err := io.CopyN(&bsor, payload, int64(bsorLength)); read < int64(bsorLength) {
+		return nil, archiveError(err)
+	}
+
+	bsorReader := newBytesDecodeReader(bsor.Bytes(), limits)
+	bsorReader.exactStrings = true
+
+	replay, err := readReplay(bsorReader, &readOptions{limits: limits})
+	if err != nil {
+		return nil, err
+	}
+
+	framesCount, err := binary.ReadUvarint(payload)
+	if err != nil {
+		return nil, archiveError(err)
+	}
+
+	if framesCount > math.MaxInt32/frameSize {
+		return nil, ErrInvalidArchive
+	}
+
+	if limits.MaxFrames > 0 && framesCount > uint64(limits.MaxFrames) {
+		return nil, limitError("frames", int64(framesCount), int64(limits.MaxFrames))
+	}
+
+	if err = checkArchiveBytes(&limits, bsorLength+framesCount*frameSize); err != nil {
+		return nil, err
+	}
+
+	// frames count is not trusted until all the columns are read
+	var columns bytes.Buffer
+	if read, err := io.CopyN(&columns, payload, int64(framesCount)*frameSize); read < int64(framesCount)*frameSize {
+		return nil, archiveError(err)
+	}
+
+	n := int(framesCount)
+	planes := columns.Bytes()
+	words := make([]uint32, frameWords*n)
+	for column := 0; column < frameWords; column++ {
+		var previous uint32
+		for i := 0; i < n; i++ {
+			delta := uint32(planes[i])<<24 | uint32(planes[n+i])<<16 | uint32(planes[2*n+i])<<8 | uint32(planes[3*n+i])
+			previous += uint32(unzigzag(delta))
+			words[column*n+i] = previous
+		}
+
+		planes = planes[4*n:]
+	}
+
+	replay.Frames = make([]Frame, framesCount)
+	for i := range replay.Frames {
+		var data [frameSize]byte
+		for column := 0; column < frameWords; column++ {
+			byteOrder.PutUint32(data[column*4:], words[column*n+i])
+		}
+
+		decodeFrame(data[:], &replay.Frames[i])
+	}
+
+	return replay, nil
+}
+
+// checkArchiveBytes checks the size of the replay declared by the archive before it is read
+func checkArchiveBytes(limits *Limits, size uint64) error {
+	if max := limits.MaxTotalBytes; max > 0 && size > uint64(max) {
+		declared := int64(math.MaxInt64)
+		if size < math.MaxInt64 {
+			declared = int64(size)
+		}
+
+		return limitError("bytes", declared, max)
+	}
+
+	return nil
+}
+
+func archiveError(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+func frameWord(frame *Frame, column int) uint32 {
+	switch column {
+	case 0:
+		return math.Float32bits(frame.Time)
+	case 1:
+		return uint32(frame.Fps)
+	}
+
+	column -= 2
+	hands := [3]*PositionAndRotation{&frame.Head, &frame.LeftHand, &frame.RightHand}
+	value := hands[column/7]
+
+	switch column % 7 {
+	case 0:
+		return math.Float32bits(value.Position.X)
+	case 1:
+		return math.Float32bits(value.Position.Y)
+	case 2:
+		return math.Float32bits(value.Position.Z)
+	case 3:
+		return math.Float32bits(value.Rotation.X)
+	case 4:
+		return math.Float32bits(value.Rotation.Y)
+	case 5:
+		return math.Float32bits(value.Rotation.Z)
+	default:
+		return math.Float32bits(value.Rotation.W)
+	}
+}
+
+func writeUvarint(buffer *bytes.Buffer, value uint64) {
+	var data [binary.MaxVarintLen64]byte
+	buffer.Write(data[:binary.PutUvarint(data[:], value)])
+}
+
+func zigzag(value int32) uint32 {
+	return uint32(value<<1) ^ uint32(value>>31)
+}
+
+func unzigzag(value uint32) int32 {
+	return int32(value>>1 ^ -(value & 1))
+}
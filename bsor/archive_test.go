@@ -0,0 +1,175 @@
+package bsor
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	withoutOptionalParts := testReplay(300)
+	withoutOptionalParts.ControllerOffsets = nil
+	withoutOptionalParts.CustomData = nil
+
+	// values are stored as differences of their bits, so any bits have to survive
+	unusualValues := testReplay(300)
+	unusualValues.Frames[1].Head.Position.X = ReplayFloat(math.NaN())
+	unusualValues.Frames[2].Head.Position.Y = ReplayFloat(math.Inf(-1))
+	unusualValues.Frames[3].Time = -unusualValues.Frames[3].Time
+	unusualValues.Frames[4].Fps = math.MinInt32
+
+	tests := []struct {
+		name   string
+		replay *Replay
+	}{
+		{"all parts", testReplay(300)},
+		{"without optional parts", withoutOptionalParts},
+		{"no frames", testReplay(0)},
+		{"unusual values", unusualValues},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var archive bytes.Buffer
+			if err := Archive(&archive, test.replay); err != nil {
+				t.Fatal(err)
+			}
+
+			replay, err := Unarchive(&archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(writeReplay(t, replay), writeReplay(t, test.replay)) {
+				t.Errorf("unarchived replay is written differently than the original one")
+			}
+		})
+	}
+}
+
+func TestUnarchiveInvalid(t *testing.T) {
+	var archive bytes.Buffer
+	if err := Archive(&archive, testReplay(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"replay", writeReplay(t, testReplay(10)), ErrNotArchive},
+		{"unknown version", append([]byte{'B', 'S', 'R', 'A', 2}, archive.Bytes()[5:]...), ErrUnknownArchiveVersion},
+		{"truncated", archive.Bytes()[:archive.Len()/2], nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Unarchive(bytes.NewReader(test.data))
+			if err == nil || test.err != nil && !errors.Is(err, test.err) {
+				t.Errorf("got %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestUnarchiveLimits(t *testing.T) {
+	var archive bytes.Buffer
+	if err := Archive(&archive, testReplay(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	// zeros compress so well that a tiny archive declares millions of frames
+	withoutFrames := testReplay(0)
+	bsor := writeReplay(t, withoutFrames)
+
+	var payload bytes.Buffer
+	writeUvarint(&payload, uint64(len(bsor)))
+	payload.Write(bsor)
+	writeUvarint(&payload, 5_000_000)
+
+	bomb := bytes.NewBuffer(append(append([]byte{}, archiveMagic...), archiveVersion))
+
+	encoder, err := zstd.NewWriter(bomb, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoder.Write(payload.Bytes())
+
+	zeros := make([]byte, 1000*frameSize)
+	for i := 0; i < 5000; i++ {
+		encoder.Write(zeros)
+	}
+
+	if err = encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		options []ReadOption
+	}{
+		{"too many frames", bomb.Bytes(), nil},
+		{"frames limit", archive.Bytes(), []ReadOption{WithLimits(Limits{MaxFrames: 99})}},
+		{"bytes limit", archive.Bytes(), []ReadOption{WithLimits(Limits{MaxTotalBytes: int64(len(bsor))})}},
+		{"notes limit", archive.Bytes(), []ReadOption{WithLimits(Limits{MaxNotes: 1})}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Unarchive(bytes.NewReader(test.data), test.options...); !errors.Is(err, ErrLimitExceeded) {
+				t.Errorf("got %v, want %v", err, ErrLimitExceeded)
+			}
+		})
+	}
+}
+
+// BenchmarkArchive reports the size of the replay divided by the size of its archive as the ratio metric.
+// It uses a synthetic replay, real ones are used instead if BSOR_REPLAYS points at a directory with them.
+func BenchmarkArchive(b *testing.B) {
+	replays := map[string][]byte{"synthetic": benchmarkData(b)}
+
+	if dir := os.Getenv("BSOR_REPLAYS"); dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.bsor"))
+		if err != nil || len(files) == 0 {
+			b.Fatalf("no replays in %v", dir)
+		}
+
+		replays = make(map[string][]byte, len(files))
+		for _, file := range files {
+			if replays[filepath.Base(file)], err = os.ReadFile(file); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	for name, data := range replays {
+		replay, err := ReadBytes(data)
+		if err != nil {
+			b.Fatalf("%v: %v", name, err)
+		}
+
+		b.Run(name, func(b *testing.B) {
+			var archive bytes.Buffer
+
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+
+			for i := 0; i < b.N; i++ {
+				archive.Reset()
+				if err := Archive(&archive, replay); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ReportMetric(float64(len(data))/float64(archive.Len()), "ratio")
+		})
+	}
+}
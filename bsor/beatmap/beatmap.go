@@ -0,0 +1,187 @@
+package beatmap
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+var ErrInfoNotFound = errors.New("Info.dat not found")
+var ErrUnsupportedVersion = errors.New("unsupported beatmap version")
+var ErrDifficultyNotFound = errors.New("difficulty not found in the beatmap")
+
+var infoFileNames = []string{"Info.dat", "info.dat"}
+
+type Info struct {
+	Version         string          `json:"version"`
+	SongName        string          `json:"songName"`
+	SongSubName     string          `json:"songSubName"`
+	SongAuthorName  string          `json:"songAuthorName"`
+	LevelAuthorName string          `json:"levelAuthorName"`
+	BPM             float64         `json:"bpm"`
+	SongTimeOffset  float64         `json:"songTimeOffset"`
+	DifficultySets  []DifficultySet `json:"difficultySets"`
+}
+
+type DifficultySet struct {
+	Characteristic string           `json:"characteristic"`
+	Difficulties   []DifficultyInfo `json:"difficulties"`
+}
+
+type DifficultyInfo struct {
+	Difficulty     string  `json:"difficulty"`
+	Rank           int     `json:"rank"`
+	FileName       string  `json:"fileName"`
+	NoteJumpSpeed  float64 `json:"noteJumpSpeed"`
+	NoteJumpOffset float64 `json:"noteJumpOffset"`
+}
+
+type infoV2 struct {
+	Version         string  `json:"_version"`
+	SongName        string  `json:"_songName"`
+	SongSubName     string  `json:"_songSubName"`
+	SongAuthorName  string  `json:"_songAuthorName"`
+	LevelAuthorName string  `json:"_levelAuthorName"`
+	BPM             float64 `json:"_beatsPerMinute"`
+	SongTimeOffset  float64 `json:"_songTimeOffset"`
+	DifficultySets  []struct {
+		Characteristic string `json:"_beatmapCharacteristicName"`
+		Difficulties   []struct {
+			Difficulty     string  `json:"_difficulty"`
+			Rank           int     `json:"_difficultyRank"`
+			FileName       string  `json:"_beatmapFilename"`
+			NoteJumpSpeed  float64 `json:"_noteJumpMovementSpeed"`
+			NoteJumpOffset float64 `json:"_noteJumpStartBeatOffset"`
+		} `json:"_difficultyBeatmaps"`
+	} `json:"_difficultyBeatmapSets"`
+}
+
+// Map is a beatmap folder with all its difficulties parsed.
+type Map struct {
+	Info Info
+	// Hash is the uppercase hex sha1 of Info.dat and all difficulty files, the same as Info.Hash of replays
+	Hash         string
+	Difficulties []*Difficulty
+}
+
+// Load reads Info.dat and all the difficulties it lists from the root of fsys.
+func Load(fsys fs.FS) (*Map, error) {
+	infoData, err := readInfoFile(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := parseInfo(infoData)
+	if err != nil {
+		return nil, err
+	}
+
+	beatmap := &Map{Info: *info}
+
+	hash := sha1.New()
+	hash.Write(infoData)
+
+	for _, set := range info.DifficultySets {
+		for _, difficultyInfo := range set.Difficulties {
+			data, err := fs.ReadFile(fsys, difficultyInfo.FileName)
+			if err != nil {
+				return nil, err
+			}
+
+			hash.Write(data)
+
+			difficulty, err := ParseDifficulty(data, info.BPM)
+			if err != nil {
+				return nil, &DifficultyError{FileName: difficultyInfo.FileName, Err: err}
+			}
+
+			difficulty.Characteristic = set.Characteristic
+			difficulty.Difficulty = difficultyInfo.Difficulty
+			beatmap.Difficulties = append(beatmap.Difficulties, difficulty)
+		}
+	}
+
+	beatmap.Hash = strings.ToUpper(hex.EncodeToString(hash.Sum(nil)))
+
+	return beatmap, nil
+}
+
+// LoadDir reads the beatmap folder.
+func LoadDir(dir string) (*Map, error) {
+	return Load(os.DirFS(dir))
+}
+
+func readInfoFile(fsys fs.FS) ([]byte, error) {
+	for _, name := range infoFileNames {
+		data, err := fs.ReadFile(fsys, name)
+		if err == nil {
+			return data, nil
+		}
+
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	return nil, ErrInfoNotFound
+}
+
+func parseInfo(data []byte) (*Info, error) {
+	var raw infoV2
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	if raw.Version == "" || !strings.HasPrefix(raw.Version, "2.") {
+		return nil, ErrUnsupportedVersion
+	}
+
+	info := &Info{
+		Version:         raw.Version,
+		SongName:        raw.SongName,
+		SongSubName:     raw.SongSubName,
+		SongAuthorName:  raw.SongAuthorName,
+		LevelAuthorName: raw.LevelAuthorName,
+		BPM:             raw.BPM,
+		SongTimeOffset:  raw.SongTimeOffset,
+		DifficultySets:  make([]DifficultySet, 0, len(raw.DifficultySets)),
+	}
+
+	for _, rawSet := range raw.DifficultySets {
+		set := DifficultySet{Characteristic: rawSet.Characteristic, Difficulties: make([]DifficultyInfo, 0, len(rawSet.Difficulties))}
+
+		for _, difficulty := range rawSet.Difficulties {
+			set.Difficulties = append(set.Difficulties, DifficultyInfo(difficulty))
+		}
+
+		info.DifficultySets = append(info.DifficultySets, set)
+	}
+
+	return info, nil
+}
+
+// Difficulty returns the difficulty of the characteristic (replay's Info.Mode) and name (replay's Info.Difficulty).
+func (m *Map) Difficulty(characteristic string, difficulty string) (*Difficulty, error) {
+	for _, d := range m.Difficulties {
+		if strings.EqualFold(d.Characteristic, characteristic) && strings.EqualFold(d.Difficulty, difficulty) {
+			return d, nil
+		}
+	}
+
+	return nil, ErrDifficultyNotFound
+}
+
+type DifficultyError struct {
+	FileName string
+	Err      error
+}
+
+func (e *DifficultyError) Error() string {
+	return e.FileName + ": " + e.Err.Error()
+}
+
+func (e *DifficultyError) Unwrap() error { return e.Err }
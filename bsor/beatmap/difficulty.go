@@ -0,0 +1,445 @@
+package beatmap
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/motzel/go-bsor/bsor"
+)
+
+// two beats closer than this are the same beat, beats in map files are float values written by editors
+const beatEpsilon = 1e-3
+
+// Note is a note spawned by the game, times are in seconds of the song, as in replays. Chain elements
+// are notes too, with the approximate position along the chain.
+type Note struct {
+	Beat        float64              `json:"beat"`
+	Time        bsor.TimeValue       `json:"time"`
+	Line        int                  `json:"line"`
+	Layer       int                  `json:"layer"`
+	Color       bsor.ColorType       `json:"color"`
+	Direction   bsor.CutDirection    `json:"direction"`
+	ScoringType bsor.NoteScoringType `json:"scoringType"`
+}
+
+type Bomb struct {
+	Beat  float64        `json:"beat"`
+	Time  bsor.TimeValue `json:"time"`
+	Line  int            `json:"line"`
+	Layer int            `json:"layer"`
+}
+
+type Obstacle struct {
+	Beat     float64        `json:"beat"`
+	Time     bsor.TimeValue `json:"time"`
+	Duration float64        `json:"duration"`
+	Line     int            `json:"line"`
+	Layer    int            `json:"layer"`
+	Width    int            `json:"width"`
+	Height   int            `json:"height"`
+}
+
+// Arc connects two notes of the same color, which then become slider head and tail.
+type Arc struct {
+	Color         bsor.ColorType    `json:"color"`
+	Beat          float64           `json:"beat"`
+	Line          int               `json:"line"`
+	Layer         int               `json:"layer"`
+	Direction     bsor.CutDirection `json:"direction"`
+	TailBeat      float64           `json:"tailBeat"`
+	TailLine      int               `json:"tailLine"`
+	TailLayer     int               `json:"tailLayer"`
+	TailDirection bsor.CutDirection `json:"tailDirection"`
+}
+
+// Chain turns the note at its head into burst slider head followed by SliceCount-1 elements.
+type Chain struct {
+	Color      bsor.ColorType    `json:"color"`
+	Beat       float64           `json:"beat"`
+	Line       int               `json:"line"`
+	Layer      int               `json:"layer"`
+	Direction  bsor.CutDirection `json:"direction"`
+	TailBeat   float64           `json:"tailBeat"`
+	TailLine   int               `json:"tailLine"`
+	TailLayer  int               `json:"tailLayer"`
+	SliceCount int               `json:"sliceCount"`
+	Squish     float64           `json:"squish"`
+}
+
+type BPMChange struct {
+	Beat float64 `json:"beat"`
+	BPM  float64 `json:"bpm"`
+}
+
+type Difficulty struct {
+	Characteristic string `json:"characteristic"`
+	Difficulty     string `json:"difficulty"`
+	Version        string `json:"version"`
+	// BPM is the initial BPM of the song from Info.dat
+	BPM float64 `json:"bpm"`
+	// Notes holds color notes and chain elements sorted by time, with scoring types the game assigns
+	Notes      []Note      `json:"notes"`
+	Bombs      []Bomb      `json:"bombs"`
+	Obstacles  []Obstacle  `json:"obstacles"`
+	Arcs       []Arc       `json:"arcs"`
+	Chains     []Chain     `json:"chains"`
+	BPMChanges []BPMChange `json:"bpmChanges"`
+}
+
+type difficultyVersion struct {
+	Version   string `json:"version"`
+	VersionV2 string `json:"_version"`
+}
+
+type difficultyV2 struct {
+	Notes []struct {
+		Time         float64 `json:"_time"`
+		LineIndex    int     `json:"_lineIndex"`
+		LineLayer    int     `json:"_lineLayer"`
+		Type         int     `json:"_type"`
+		CutDirection int     `json:"_cutDirection"`
+	} `json:"_notes"`
+	Obstacles []struct {
+		Time      float64 `json:"_time"`
+		LineIndex int     `json:"_lineIndex"`
+		Type      int     `json:"_type"`
+		Duration  float64 `json:"_duration"`
+		Width     int     `json:"_width"`
+	} `json:"_obstacles"`
+	Sliders []struct {
+		ColorType        int     `json:"_colorType"`
+		HeadTime         float64 `json:"_headTime"`
+		HeadLineIndex    int     `json:"_headLineIndex"`
+		HeadLineLayer    int     `json:"_headLineLayer"`
+		HeadCutDirection int     `json:"_headCutDirection"`
+		TailTime         float64 `json:"_tailTime"`
+		TailLineIndex    int     `json:"_tailLineIndex"`
+		TailLineLayer    int     `json:"_tailLineLayer"`
+		TailCutDirection int     `json:"_tailCutDirection"`
+	} `json:"_sliders"`
+	Events []struct {
+		Time       float64 `json:"_time"`
+		Type       int     `json:"_type"`
+		FloatValue float64 `json:"_floatValue"`
+	} `json:"_events"`
+}
+
+// v2 note types, 1 and 2 are unused
+const (
+	v2Red  = 0
+	v2Blue = 1
+	v2Bomb = 3
+
+	v2BpmChangeEvent = 100
+)
+
+type difficultyV3 struct {
+	BPMEvents []struct {
+		Beat float64 `json:"b"`
+		BPM  float64 `json:"m"`
+	} `json:"bpmEvents"`
+	ColorNotes []struct {
+		Beat      float64 `json:"b"`
+		X         int     `json:"x"`
+		Y         int     `json:"y"`
+		Color     int     `json:"c"`
+		Direction int     `json:"d"`
+	} `json:"colorNotes"`
+	BombNotes []struct {
+		Beat float64 `json:"b"`
+		X    int     `json:"x"`
+		Y    int     `json:"y"`
+	} `json:"bombNotes"`
+	Obstacles []struct {
+		Beat     float64 `json:"b"`
+		X        int     `json:"x"`
+		Y        int     `json:"y"`
+		Duration float64 `json:"d"`
+		Width    int     `json:"w"`
+		Height   int     `json:"h"`
+	} `json:"obstacles"`
+	Sliders []struct {
+		Color         int     `json:"c"`
+		Beat          float64 `json:"b"`
+		X             int     `json:"x"`
+		Y             int     `json:"y"`
+		Direction     int     `json:"d"`
+		TailBeat      float64 `json:"tb"`
+		TailX         int     `json:"tx"`
+		TailY         int     `json:"ty"`
+		TailDirection int     `json:"tc"`
+	} `json:"sliders"`
+	BurstSliders []struct {
+		Color      int     `json:"c"`
+		Beat       float64 `json:"b"`
+		X          int     `json:"x"`
+		Y          int     `json:"y"`
+		Direction  int     `json:"d"`
+		TailBeat   float64 `json:"tb"`
+		TailX      int     `json:"tx"`
+		TailY      int     `json:"ty"`
+		SliceCount int     `json:"sc"`
+		Squish     float64 `json:"s"`
+	} `json:"burstSliders"`
+}
+
+// ParseDifficulty parses v2 or v3 difficulty file, bpm is the initial BPM from Info.dat.
+// Characteristic and Difficulty are set only by Load.
+func ParseDifficulty(data []byte, bpm float64) (*Difficulty, error) {
+	var version difficultyVersion
+	if err := json.Unmarshal(data, &version); err != nil {
+		return nil, err
+	}
+
+	var difficulty *Difficulty
+	var err error
+
+	switch {
+	case strings.HasPrefix(version.Version, "3."):
+		difficulty, err = parseDifficultyV3(data)
+	case strings.HasPrefix(version.VersionV2, "2.") || version.Version == "" && version.VersionV2 == "":
+		// very old maps have no version at all
+		difficulty, err = parseDifficultyV2(data)
+	default:
+		return nil, ErrUnsupportedVersion
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	difficulty.Version = version.Version + version.VersionV2
+	difficulty.BPM = bpm
+
+	difficulty.assignScoringTypes()
+	difficulty.addChainElements()
+	difficulty.computeTimes()
+
+	return difficulty, nil
+}
+
+func parseDifficultyV2(data []byte) (*Difficulty, error) {
+	var raw difficultyV2
+	difficulty := &Difficulty{}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	for _, note := range raw.Notes {
+		switch note.Type {
+		case v2Red, v2Blue:
+			difficulty.Notes = append(difficulty.Notes, Note{
+				Beat:        note.Time,
+				Line:        note.LineIndex,
+				Layer:       note.LineLayer,
+				Color:       bsor.ColorType(note.Type),
+				Direction:   bsor.CutDirection(note.CutDirection),
+				ScoringType: bsor.Normal,
+			})
+		case v2Bomb:
+			difficulty.Bombs = append(difficulty.Bombs, Bomb{Beat: note.Time, Line: note.LineIndex, Layer: note.LineLayer})
+		}
+	}
+
+	for _, obstacle := range raw.Obstacles {
+		// full height walls and crouch walls
+		layer, height := 0, 5
+		if obstacle.Type == 1 {
+			layer, height = 2, 3
+		}
+
+		difficulty.Obstacles = append(difficulty.Obstacles, Obstacle{
+			Beat:     obstacle.Time,
+			Duration: obstacle.Duration,
+			Line:     obstacle.LineIndex,
+			Layer:    layer,
+			Width:    obstacle.Width,
+			Height:   height,
+		})
+	}
+
+	for _, slider := range raw.Sliders {
+		difficulty.Arcs = append(difficulty.Arcs, Arc{
+			Color:         bsor.ColorType(slider.ColorType),
+			Beat:          slider.HeadTime,
+			Line:          slider.HeadLineIndex,
+			Layer:         slider.HeadLineLayer,
+			Direction:     bsor.CutDirection(slider.HeadCutDirection),
+			TailBeat:      slider.TailTime,
+			TailLine:      slider.TailLineIndex,
+			TailLayer:     slider.TailLineLayer,
+			TailDirection: bsor.CutDirection(slider.TailCutDirection),
+		})
+	}
+
+	for _, event := range raw.Events {
+		if event.Type == v2BpmChangeEvent {
+			difficulty.BPMChanges = append(difficulty.BPMChanges, BPMChange{Beat: event.Time, BPM: event.FloatValue})
+		}
+	}
+
+	return difficulty, nil
+}
+
+func parseDifficultyV3(data []byte) (*Difficulty, error) {
+	var raw difficultyV3
+	difficulty := &Difficulty{}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	for _, note := range raw.ColorNotes {
+		difficulty.Notes = append(difficulty.Notes, Note{
+			Beat:        note.Beat,
+			Line:        note.X,
+			Layer:       note.Y,
+			Color:       bsor.ColorType(note.Color),
+			Direction:   bsor.CutDirection(note.Direction),
+			ScoringType: bsor.Normal,
+		})
+	}
+
+	for _, bomb := range raw.BombNotes {
+		difficulty.Bombs = append(difficulty.Bombs, Bomb{Beat: bomb.Beat, Line: bomb.X, Layer: bomb.Y})
+	}
+
+	for _, obstacle := range raw.Obstacles {
+		difficulty.Obstacles = append(difficulty.Obstacles, Obstacle{
+			Beat:     obstacle.Beat,
+			Duration: obstacle.Duration,
+			Line:     obstacle.X,
+			Layer:    obstacle.Y,
+			Width:    obstacle.Width,
+			Height:   obstacle.Height,
+		})
+	}
+
+	for _, slider := range raw.Sliders {
+		difficulty.Arcs = append(difficulty.Arcs, Arc{
+			Color:         bsor.ColorType(slider.Color),
+			Beat:          slider.Beat,
+			Line:          slider.X,
+			Layer:         slider.Y,
+			Direction:     bsor.CutDirection(slider.Direction),
+			TailBeat:      slider.TailBeat,
+			TailLine:      slider.TailX,
+			TailLayer:     slider.TailY,
+			TailDirection: bsor.CutDirection(slider.TailDirection),
+		})
+	}
+
+	for _, chain := range raw.BurstSliders {
+		difficulty.Chains = append(difficulty.Chains, Chain{
+			Color:      bsor.ColorType(chain.Color),
+			Beat:       chain.Beat,
+			Line:       chain.X,
+			Layer:      chain.Y,
+			Direction:  bsor.CutDirection(chain.Direction),
+			TailBeat:   chain.TailBeat,
+			TailLine:   chain.TailX,
+			TailLayer:  chain.TailY,
+			SliceCount: chain.SliceCount,
+			Squish:     chain.Squish,
+		})
+	}
+
+	for _, event := range raw.BPMEvents {
+		difficulty.BPMChanges = append(difficulty.BPMChanges, BPMChange{Beat: event.Beat, BPM: event.BPM})
+	}
+
+	return difficulty, nil
+}
+
+func (d *Difficulty) findNote(beat float64, line int, layer int, color bsor.ColorType) *Note {
+	for i := range d.Notes {
+		note := &d.Notes[i]
+		if math.Abs(note.Beat-beat) < beatEpsilon && note.Line == line && note.Layer == layer && note.Color == color {
+			return note
+		}
+	}
+
+	return nil
+}
+
+// assignScoringTypes marks notes attached to arcs and chains, chain heads take precedence over arc ends
+func (d *Difficulty) assignScoringTypes() {
+	for _, arc := range d.Arcs {
+		if head := d.findNote(arc.Beat, arc.Line, arc.Layer, arc.Color); head != nil && head.ScoringType == bsor.Normal {
+			head.ScoringType = bsor.SliderHead
+		}
+
+		if tail := d.findNote(arc.TailBeat, arc.TailLine, arc.TailLayer, arc.Color); tail != nil && tail.ScoringType == bsor.Normal {
+			tail.ScoringType = bsor.SliderTail
+		}
+	}
+
+	for _, chain := range d.Chains {
+		if head := d.findNote(chain.Beat, chain.Line, chain.Layer, chain.Color); head != nil {
+			head.ScoringType = bsor.BurstSliderHead
+		}
+	}
+}
+
+// addChainElements adds SliceCount-1 elements of every chain, evenly spread between its head and tail
+func (d *Difficulty) addChainElements() {
+	for _, chain := range d.Chains {
+		for i := 1; i < chain.SliceCount; i++ {
+			t := float64(i) / float64(chain.SliceCount-1)
+
+			d.Notes = append(d.Notes, Note{
+				Beat:        chain.Beat + (chain.TailBeat-chain.Beat)*t,
+				Line:        int(math.Round(float64(chain.Line) + float64(chain.TailLine-chain.Line)*t)),
+				Layer:       int(math.Round(float64(chain.Layer) + float64(chain.TailLayer-chain.Layer)*t)),
+				Color:       chain.Color,
+				Direction:   bsor.Dot,
+				ScoringType: bsor.BurstSliderElement,
+			})
+		}
+	}
+
+	sort.SliceStable(d.Notes, func(i, j int) bool { return d.Notes[i].Beat < d.Notes[j].Beat })
+}
+
+func (d *Difficulty) computeTimes() {
+	sort.SliceStable(d.BPMChanges, func(i, j int) bool { return d.BPMChanges[i].Beat < d.BPMChanges[j].Beat })
+
+	for i := range d.Notes {
+		d.Notes[i].Time = d.Time(d.Notes[i].Beat)
+	}
+
+	for i := range d.Bombs {
+		d.Bombs[i].Time = d.Time(d.Bombs[i].Beat)
+	}
+
+	for i := range d.Obstacles {
+		d.Obstacles[i].Time = d.Time(d.Obstacles[i].Beat)
+	}
+
+	sort.SliceStable(d.Bombs, func(i, j int) bool { return d.Bombs[i].Beat < d.Bombs[j].Beat })
+	sort.SliceStable(d.Obstacles, func(i, j int) bool { return d.Obstacles[i].Beat < d.Obstacles[j].Beat })
+}
+
+// Time converts the beat to seconds, following BPM changes of the difficulty.
+func (d *Difficulty) Time(beat float64) bsor.TimeValue {
+	var seconds, lastBeat float64
+	bpm := d.BPM
+
+	for _, change := range d.BPMChanges {
+		if change.Beat > beat {
+			break
+		}
+
+		if change.BPM <= 0 {
+			continue
+		}
+
+		seconds += (change.Beat - lastBeat) * 60 / bpm
+		lastBeat, bpm = change.Beat, change.BPM
+	}
+
+	return bsor.TimeValue(seconds + (beat-lastBeat)*60/bpm)
+}
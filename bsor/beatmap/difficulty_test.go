@@ -0,0 +1,85 @@
+package beatmap
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/motzel/go-bsor/bsor"
+)
+
+// both fixtures start at 120 BPM, half a second per beat, and slow down to 60 BPM at beat 8
+const testBPM = 120
+
+func loadTestDifficulty(t *testing.T, name string) *Difficulty {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	difficulty, err := ParseDifficulty(data, testBPM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return difficulty
+}
+
+func TestParseDifficulty(t *testing.T) {
+	tests := []struct {
+		file    string
+		version string
+		notes   []Note
+		bombs   []Bomb
+	}{
+		{
+			file:    "v2.dat",
+			version: "2.6.0",
+			notes: []Note{
+				{Beat: 2, Time: 1, Line: 1, Layer: 0, Color: bsor.Red, Direction: bsor.BottomCenter, ScoringType: bsor.SliderHead},
+				{Beat: 4, Time: 2, Line: 2, Layer: 0, Color: bsor.Red, Direction: bsor.BottomCenter, ScoringType: bsor.SliderTail},
+				{Beat: 6, Time: 3, Line: 1, Layer: 1, Color: bsor.Blue, Direction: bsor.TopCenter, ScoringType: bsor.Normal},
+				{Beat: 10, Time: 6, Line: 3, Layer: 2, Color: bsor.Blue, Direction: bsor.Dot, ScoringType: bsor.Normal},
+			},
+			bombs: []Bomb{{Beat: 5, Time: 2.5}},
+		},
+		{
+			file:    "v3.dat",
+			version: "3.2.0",
+			notes: []Note{
+				{Beat: 2, Time: 1, Line: 1, Layer: 0, Color: bsor.Red, Direction: bsor.BottomCenter, ScoringType: bsor.SliderHead},
+				{Beat: 4, Time: 2, Line: 2, Layer: 0, Color: bsor.Red, Direction: bsor.BottomCenter, ScoringType: bsor.SliderTail},
+				{Beat: 6, Time: 3, Line: 1, Layer: 1, Color: bsor.Blue, Direction: bsor.TopCenter, ScoringType: bsor.BurstSliderHead},
+				{Beat: 6.5, Time: 3.25, Line: 1, Layer: 2, Color: bsor.Blue, Direction: bsor.Dot, ScoringType: bsor.BurstSliderElement},
+				{Beat: 7, Time: 3.5, Line: 1, Layer: 2, Color: bsor.Blue, Direction: bsor.Dot, ScoringType: bsor.BurstSliderElement},
+				{Beat: 10, Time: 6, Line: 3, Layer: 2, Color: bsor.Blue, Direction: bsor.Dot, ScoringType: bsor.Normal},
+			},
+			bombs: []Bomb{{Beat: 5, Time: 2.5}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			difficulty := loadTestDifficulty(t, test.file)
+
+			if difficulty.Version != test.version {
+				t.Errorf("got version %v, want %v", difficulty.Version, test.version)
+			}
+
+			if !reflect.DeepEqual(difficulty.Notes, test.notes) {
+				t.Errorf("got notes %+v, want %+v", difficulty.Notes, test.notes)
+			}
+
+			if !reflect.DeepEqual(difficulty.Bombs, test.bombs) {
+				t.Errorf("got bombs %+v, want %+v", difficulty.Bombs, test.bombs)
+			}
+
+			if len(difficulty.Obstacles) != 1 || difficulty.Obstacles[0].Time != 0.5 || difficulty.Obstacles[0].Layer != 2 {
+				t.Errorf("got obstacles %+v, want a crouch wall at 0.5s", difficulty.Obstacles)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package beatmap
+
+import "github.com/motzel/go-bsor/bsor"
+
+// MaxScore returns the max score of all the notes of the difficulty, with chain heads and elements
+// scored like the game does.
+func (d *Difficulty) MaxScore() bsor.Score {
+	scoringTypes := make([]bsor.NoteScoringType, len(d.Notes))
+	for i := range d.Notes {
+		scoringTypes[i] = d.Notes[i].ScoringType
+	}
+
+	return bsor.MaxScore(scoringTypes)
+}
+
+// NewReplayEvents returns replay events with accuracy computed against the max score of the whole difficulty,
+// together with the notes of the difficulty which have no event in the replay, like notes after a fail or quit.
+func NewReplayEvents(replay *bsor.Replay, difficulty *Difficulty) (*bsor.ReplayEvents, []Note) {
+	events := bsor.NewReplayEventsWithMaxScore(replay, difficulty.MaxScore())
+
+	matching := Match(replay, difficulty)
+
+	unmatched := make([]Note, 0, len(matching.Unmatched))
+	for _, idx := range matching.Unmatched {
+		unmatched = append(unmatched, difficulty.Notes[idx])
+	}
+
+	return events, unmatched
+}
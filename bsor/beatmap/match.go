@@ -0,0 +1,271 @@
+package beatmap
+
+import (
+	"errors"
+	"io/fs"
+	"math"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/motzel/go-bsor/bsor"
+)
+
+var ErrMapNotFound = errors.New("beatmap not found")
+
+const sha1HexLength = 40
+
+// the largest difference between spawn time of a replay note and time of a map note computed from its beat
+const matchTolerance = 0.01
+
+// Matching links replay notes to map objects.
+type Matching struct {
+	// Notes holds for every replay note the index of the matched object in Difficulty.Notes,
+	// or Difficulty.Bombs for bomb hits, or -1 if there is none
+	Notes []int
+	// Unmatched lists indexes of Difficulty.Notes which have no event in the replay
+	Unmatched []int
+}
+
+// candidates are map objects with the same key sorted by time, matched ones are marked
+type candidates struct {
+	indexes []int
+	times   []bsor.TimeValue
+	matched []bool
+}
+
+func (c *candidates) add(idx int, time bsor.TimeValue) {
+	c.indexes = append(c.indexes, idx)
+	c.times = append(c.times, time)
+	c.matched = append(c.matched, false)
+}
+
+// take marks and returns the not yet matched object closest in time, within the tolerance
+func (c *candidates) take(time bsor.TimeValue, accept func(int) bool) int {
+	start := sort.Search(len(c.times), func(i int) bool { return c.times[i] >= time-matchTolerance })
+
+	best, bestDistance := -1, math.Inf(1)
+	for i := start; i < len(c.times) && c.times[i] <= time+matchTolerance; i++ {
+		if c.matched[i] || !accept(c.indexes[i]) {
+			continue
+		}
+
+		if distance := math.Abs(float64(c.times[i] - time)); distance < bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+
+	if best < 0 {
+		return -1
+	}
+
+	c.matched[best] = true
+
+	return c.indexes[best]
+}
+
+func candidatesOf[K comparable](group map[K]*candidates, key K) *candidates {
+	c := group[key]
+	if c == nil {
+		c = &candidates{}
+		group[key] = c
+	}
+
+	return c
+}
+
+// noteID is the id the game assigns to a note and the replay stores
+func noteID(scoringType int, line int, layer int, color int, direction int) int {
+	return scoringType*10000 + line*1000 + layer*100 + color*10 + direction
+}
+
+// replayNoteID rebuilds the id stored in the replay, the fields are split with truncated division
+// so they are all negative for negative ids, like ids of bombs in the first line and layer
+func replayNoteID(note *bsor.Note) int {
+	return noteID(int(int8(note.ScoringType)), int(int8(note.LineIdx)), int(int8(note.LineLayer)), int(int8(note.ColorType)), int(int8(note.CutDirection)))
+}
+
+// positionKey is the id without scoring type, older replays did not record it
+func positionKey(note *Note) int {
+	return noteID(0, note.Line, note.Layer, int(note.Color), int(note.Direction))
+}
+
+// bombPosition decodes line and layer of the bomb from its id, which the game computes with color -1
+// and direction from 0 to 9, so adding 10 leaves scoring type, line and layer above the last two digits
+func bombPosition(id int) (line int, layer int) {
+	position := (id + 10) / 100 % 100
+
+	return position / 10, position % 10
+}
+
+// Match links every note event of the replay to the note or bomb of the difficulty with the same
+// position, color, cut direction and scoring type, spawned at the same time. Chain elements are
+// matched by color and time only. Events of a note recorded more than once match only once.
+func Match(replay *bsor.Replay, difficulty *Difficulty) *Matching {
+	notes := map[int]*candidates{}
+	chainElements := map[bsor.ColorType]*candidates{}
+	for i := range difficulty.Notes {
+		note := &difficulty.Notes[i]
+
+		if note.ScoringType == bsor.BurstSliderElement {
+			candidatesOf(chainElements, note.Color).add(i, note.Time)
+		} else {
+			candidatesOf(notes, positionKey(note)).add(i, note.Time)
+		}
+	}
+
+	bombs := map[int]*candidates{}
+	allBombs := &candidates{}
+	for i, bomb := range difficulty.Bombs {
+		candidatesOf(bombs, bomb.Line*10+bomb.Layer).add(i, bomb.Time)
+		allBombs.add(i, bomb.Time)
+	}
+
+	matching := &Matching{Notes: make([]int, len(replay.Notes))}
+	matchedNotes := make([]bool, len(difficulty.Notes))
+	matchedBombs := make([]bool, len(difficulty.Bombs))
+
+	for i := range replay.Notes {
+		note := &replay.Notes[i]
+		matching.Notes[i] = -1
+
+		switch {
+		case note.EventType == bsor.Bomb:
+			notMatched := func(idx int) bool { return !matchedBombs[idx] }
+
+			line, layer := bombPosition(replayNoteID(note))
+			idx := -1
+			if c := bombs[line*10+layer]; c != nil {
+				idx = c.take(note.SpawnTime, notMatched)
+			}
+
+			// bombs moved by mapping extensions have positions out of the grid, time is good enough then
+			if idx < 0 {
+				idx = allBombs.take(note.SpawnTime, notMatched)
+			}
+
+			if idx >= 0 {
+				matchedBombs[idx] = true
+				matching.Notes[i] = idx
+			}
+
+		case note.ScoringType == bsor.BurstSliderElement:
+			if c := chainElements[note.ColorType]; c != nil {
+				matching.Notes[i] = c.take(note.SpawnTime, func(int) bool { return true })
+			}
+
+		default:
+			id := replayNoteID(note)
+			scoringType := bsor.NoteScoringType(id / 10000)
+
+			if c := notes[id%10000]; c != nil {
+				matching.Notes[i] = c.take(note.SpawnTime, func(idx int) bool {
+					return scoringType == bsor.NormalOld || difficulty.Notes[idx].ScoringType == scoringType
+				})
+			}
+		}
+
+		if note.EventType != bsor.Bomb && matching.Notes[i] >= 0 {
+			matchedNotes[matching.Notes[i]] = true
+		}
+	}
+
+	for i, matched := range matchedNotes {
+		if !matched {
+			matching.Unmatched = append(matching.Unmatched, i)
+		}
+	}
+
+	return matching
+}
+
+// Library finds beatmaps of replays by their hash.
+type Library struct {
+	maps map[string]*Map
+	// Skipped lists folders which could not be loaded
+	Skipped []SkippedMap
+}
+
+type SkippedMap struct {
+	Dir string
+	Err error
+}
+
+func NewLibrary(maps ...*Map) *Library {
+	library := &Library{maps: make(map[string]*Map, len(maps))}
+
+	for _, beatmap := range maps {
+		library.Add(beatmap)
+	}
+
+	return library
+}
+
+func (l *Library) Add(beatmap *Map) {
+	l.maps[strings.ToUpper(beatmap.Hash)] = beatmap
+}
+
+// LoadLibrary loads every folder of fsys containing Info.dat, like CustomLevels folder of the game.
+// Folders which fail to load are listed in Skipped.
+func LoadLibrary(fsys fs.FS) (*Library, error) {
+	library := NewLibrary()
+
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		base := path.Base(name)
+		if !strings.EqualFold(base, infoFileNames[0]) {
+			return nil
+		}
+
+		dir := path.Dir(name)
+
+		sub, err := fs.Sub(fsys, dir)
+		if err != nil {
+			return err
+		}
+
+		beatmap, err := Load(sub)
+		if err != nil {
+			library.Skipped = append(library.Skipped, SkippedMap{Dir: dir, Err: err})
+		} else {
+			library.Add(beatmap)
+		}
+
+		return fs.SkipDir
+	})
+
+	return library, err
+}
+
+// Map returns the beatmap with the hash, case and custom_level_ prefix of level ids are ignored.
+func (l *Library) Map(hash string) (*Map, error) {
+	hash = strings.ToUpper(strings.TrimPrefix(hash, "custom_level_"))
+
+	// levels with the same hash loaded from different folders get a suffix after the hash
+	if len(hash) > sha1HexLength {
+		hash = hash[:sha1HexLength]
+	}
+
+	if beatmap, ok := l.maps[hash]; ok {
+		return beatmap, nil
+	}
+
+	return nil, ErrMapNotFound
+}
+
+// Difficulty returns the difficulty the replay was played on, using its Info.Hash, Info.Mode and Info.Difficulty.
+func (l *Library) Difficulty(info *bsor.Info) (*Difficulty, error) {
+	beatmap, err := l.Map(info.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return beatmap.Difficulty(info.Mode, info.Difficulty)
+}
@@ -0,0 +1,66 @@
+package beatmap
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/motzel/go-bsor/bsor"
+)
+
+func replayNote(note *Note, scoringType bsor.NoteScoringType, eventType bsor.NoteEventType) bsor.Note {
+	return bsor.Note{
+		ScoringType:  scoringType,
+		LineIdx:      bsor.LineValue(note.Line),
+		LineLayer:    bsor.LayerValue(note.Layer),
+		ColorType:    note.Color,
+		CutDirection: note.Direction,
+		EventTime:    note.Time + 0.1,
+		SpawnTime:    note.Time,
+		EventType:    eventType,
+	}
+}
+
+// bombHit is a hit of the bomb in the first line and layer at 2.5s, its id -1 is read as bytes of negative fields
+var bombHit = bsor.Note{CutDirection: 255, EventTime: 2.5, SpawnTime: 2.5, EventType: bsor.Bomb}
+
+func TestMatch(t *testing.T) {
+	v2 := loadTestDifficulty(t, "v2.dat")
+	v3 := loadTestDifficulty(t, "v3.dat")
+
+	// replays before scoring types were recorded have all notes NormalOld
+	var oldReplay bsor.Replay
+	for i := range v2.Notes {
+		oldReplay.Notes = append(oldReplay.Notes, replayNote(&v2.Notes[i], bsor.NormalOld, bsor.Good))
+	}
+	oldReplay.Notes = append(oldReplay.Notes[:2], append([]bsor.Note{bombHit}, oldReplay.Notes[2:]...)...)
+
+	var replay bsor.Replay
+	for i := range v3.Notes[:5] {
+		replay.Notes = append(replay.Notes, replayNote(&v3.Notes[i], v3.Notes[i].ScoringType, bsor.Good))
+	}
+	replay.Notes = append(replay.Notes,
+		bombHit,
+		// the same cut recorded twice
+		replayNote(&v3.Notes[0], bsor.SliderHead, bsor.Good),
+		// the last note is normal, not a slider head
+		replayNote(&v3.Notes[5], bsor.SliderHead, bsor.Miss),
+	)
+
+	tests := []struct {
+		name       string
+		replay     *bsor.Replay
+		difficulty *Difficulty
+		want       *Matching
+	}{
+		{"v2 old replay", &oldReplay, v2, &Matching{Notes: []int{0, 1, 0, 2, 3}}},
+		{"v3", &replay, v3, &Matching{Notes: []int{0, 1, 2, 3, 4, 0, -1, -1}, Unmatched: []int{5}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if matching := Match(test.replay, test.difficulty); !reflect.DeepEqual(matching, test.want) {
+				t.Errorf("got %+v, want %+v", matching, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package bsor
+
+import (
+	"bufio"
+	"io"
+	"math"
+)
+
+// Elements are decoded by hand directly from the read buffer. It avoids binary.Read, which uses
+// reflection and allocates for every call, and it's the hot path when whole archives are processed.
+
+// next consumes and returns number bytes, the returned slice is only valid until the next read
+func (r *decodeReader) next(number int) ([]byte, error) {
+	if max := r.limits.MaxTotalBytes; max > 0 && r.offset+int64(number) > max {
+		return nil, limitError("bytes", r.offset+int64(number), max)
+	}
+
+	if r.inMemory {
+		return r.nextInMemory(number)
+	}
+
+	data, err := r.buffered.Peek(number)
+	if err == bufio.ErrBufferFull {
+		data = make([]byte, number)
+		_, err = io.ReadFull(r, data)
+
+		return data, err
+	}
+
+	if err != nil {
+		// mimic io.ReadFull, EOF means that nothing was left to read
+		if len(data) > 0 && err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		discarded, _ := r.buffered.Discard(len(data))
+		r.offset += int64(discarded)
+
+		return nil, err
+	}
+
+	discarded, _ := r.buffered.Discard(number)
+	r.offset += int64(discarded)
+
+	return data, nil
+}
+
+func (r *decodeReader) nextInMemory(number int) ([]byte, error) {
+	remaining := int64(len(r.data)) - r.offset
+	if remaining <= 0 && number > 0 {
+		return nil, io.EOF
+	}
+
+	if int64(number) > remaining {
+		r.offset += remaining
+
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	// capacity is capped, so appending to the returned slice never overwrites the data
+	end := r.offset + int64(number)
+	data := r.data[r.offset:end:end]
+	r.offset = end
+
+	return data, nil
+}
+
+func (r *decodeReader) readUint32() (uint32, error) {
+	data, err := r.next(4)
+	if err != nil {
+		return 0, err
+	}
+
+	return byteOrder.Uint32(data), nil
+}
+
+func (r *decodeReader) readFloat() (ReplayFloat, error) {
+	value, err := r.readUint32()
+
+	return math.Float32frombits(value), err
+}
+
+func (r *decodeReader) readByte() (byte, error) {
+	data, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+
+	return data[0], nil
+}
+
+func (r *decodeReader) readBool() (bool, error) {
+	value, err := r.readByte()
+
+	return value != 0, err
+}
+
+func decodeFloat(data []byte) ReplayFloat {
+	return math.Float32frombits(byteOrder.Uint32(data))
+}
+
+func decodeInt(data []byte) ReplayInt {
+	return ReplayInt(byteOrder.Uint32(data))
+}
+
+func decodeVector3(data []byte, vector *Vector3) {
+	_ = data[11]
+	vector.X = decodeFloat(data[0:])
+	vector.Y = decodeFloat(data[4:])
+	vector.Z = decodeFloat(data[8:])
+}
+
+func decodePositionAndRotation(data []byte, value *PositionAndRotation) {
+	_ = data[27]
+	value.Position.X = decodeFloat(data[0:])
+	value.Position.Y = decodeFloat(data[4:])
+	value.Position.Z = decodeFloat(data[8:])
+	value.Rotation.X = decodeFloat(data[12:])
+	value.Rotation.Y = decodeFloat(data[16:])
+	value.Rotation.Z = decodeFloat(data[20:])
+	value.Rotation.W = decodeFloat(data[24:])
+}
+
+func decodeFrame(data []byte, frame *Frame) {
+	_ = data[frameSize-1]
+	frame.Time = decodeFloat(data[0:])
+	frame.Fps = decodeInt(data[4:])
+	decodePositionAndRotation(data[8:], &frame.Head)
+	decodePositionAndRotation(data[36:], &frame.LeftHand)
+	decodePositionAndRotation(data[64:], &frame.RightHand)
+}
+
+func decodeNoteCutInfo(data []byte, cutInfo *NoteCutInfo) {
+	_ = data[noteCutInfoSize-1]
+	cutInfo.SpeedOk = data[0] != 0
+	cutInfo.DirectionOk = data[1] != 0
+	cutInfo.SaberTypeOk = data[2] != 0
+	cutInfo.WasCutTooSoon = data[3] != 0
+	cutInfo.SaberSpeed = decodeFloat(data[4:])
+	decodeVector3(data[8:], &cutInfo.SaberDir)
+	cutInfo.SaberType = decodeInt(data[20:])
+	cutInfo.TimeDeviation = decodeFloat(data[24:])
+	cutInfo.CutDirDeviation = decodeFloat(data[28:])
+	decodeVector3(data[32:], &cutInfo.CutPoint)
+	decodeVector3(data[44:], &cutInfo.CutNormal)
+	cutInfo.CutDistanceToCenter = decodeFloat(data[56:])
+	cutInfo.CutAngle = decodeFloat(data[60:])
+	cutInfo.BeforeCutRating = decodeFloat(data[64:])
+	cutInfo.AfterCutRating = decodeFloat(data[68:])
+}
+
+func decodeHeight(data []byte, height *AutomaticHeight) {
+	_ = data[heightSize-1]
+	height.Height = decodeFloat(data[0:])
+	height.Time = decodeFloat(data[4:])
+}
+
+func decodePause(data []byte, pause *Pause) {
+	_ = data[pauseSize-1]
+	pause.Duration = int64(byteOrder.Uint64(data[0:]))
+	pause.Time = decodeFloat(data[8:])
+}
+
+func decodeControllerOffsets(data []byte, offsets *ControllerOffsets) {
+	_ = data[controllerOffsetsSize-1]
+	decodePositionAndRotation(data[0:], &offsets.LeftHand)
+	decodePositionAndRotation(data[28:], &offsets.RightHand)
+}
+
+// readElement reads fixed size element, size has to match the encoded size of T
+func readElement[T any](reader *decodeReader, size int, decode func([]byte, *T), element *T) error {
+	data, err := reader.next(size)
+	if err != nil {
+		return err
+	}
+
+	decode(data, element)
+
+	return nil
+}
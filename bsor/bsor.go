@@ -1,6 +1,7 @@
 package bsor
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -18,7 +19,6 @@ type Version = byte
 type LineValue = byte
 type LayerValue = byte
 type TimeValue = float32
-type Modifier = string
 type Score = ReplayInt
 
 type Header struct {
@@ -72,6 +72,8 @@ type PositionAndRotation struct {
 
 type PartType ReplayInt
 
+const UnknownPart PartType = -1
+
 const (
 	InfoPart PartType = iota
 	FramesPart
@@ -79,6 +81,8 @@ const (
 	WallsPart
 	HeightsPart
 	PausesPart
+	ControllerOffsetsPart
+	CustomDataPart
 )
 
 func (s PartType) String() string {
@@ -95,6 +99,10 @@ func (s PartType) String() string {
 		return "Heights"
 	case PausesPart:
 		return "Pauses"
+	case ControllerOffsetsPart:
+		return "ControllerOffsets"
+	case CustomDataPart:
+		return "CustomData"
 	default:
 		return "Unknown"
 	}
@@ -277,18 +285,34 @@ type Pause struct {
 	Time     TimeValue `json:"time"`
 }
 
+type ControllerOffsets struct {
+	LeftHand  PositionAndRotation `json:"leftHand"`
+	RightHand PositionAndRotation `json:"rightHand"`
+}
+
+type CustomData struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
 type Replay struct {
 	Header
-	Info    Info              `json:"info"`
-	Frames  []Frame           `json:"frames"`
-	Notes   []Note            `json:"notes"`
-	Walls   []WallHit         `json:"walls"`
-	Heights []AutomaticHeight `json:"heights"`
-	Pauses  []Pause           `json:"pauses"`
+	Info              Info               `json:"info"`
+	Frames            []Frame            `json:"frames"`
+	Notes             []Note             `json:"notes"`
+	Walls             []WallHit          `json:"walls"`
+	Heights           []AutomaticHeight  `json:"heights"`
+	Pauses            []Pause            `json:"pauses"`
+	ControllerOffsets *ControllerOffsets `json:"controllerOffsets,omitempty"`
+	CustomData        []CustomData       `json:"customData,omitempty"`
+	// Extensions holds data of parts added by RegisterVersion, decoders store it by their part type
+	Extensions map[PartType]any `json:"extensions,omitempty"`
 }
 
 var byteOrder = binary.LittleEndian
 
+const bsorMagic ReplayInt = 0x442d3d69
+
 type Error struct {
 	msg string
 }
@@ -300,305 +324,581 @@ var ErrUnknownBsorVersion = Error{"unknown BSOR version"}
 var ErrUnknownPart = Error{"unknown file part"}
 var ErrDecodeField = Error{"invalid value encountered"}
 
-func wrapError(err error) error {
-	var e *Error
-	if errors.As(err, &e) {
-		return fmt.Errorf("bsor read error: %w", e)
+// ErrInvalidLength is a negative count or length, the data following it can not be located anymore
+var ErrInvalidLength = Error{"invalid count or length"}
+
+type DecodeError struct {
+	Part   PartType `json:"part"`
+	Index  int      `json:"index"`
+	Field  string   `json:"field"`
+	Offset int64    `json:"offset"`
+	Err    error    `json:"-"`
+}
+
+func (e *DecodeError) Error() string {
+	return "bsor read error: " + e.message()
+}
+
+func (e *DecodeError) message() string {
+	var context []string
+
+	if e.Part != UnknownPart {
+		context = append(context, fmt.Sprintf("%v part", e.Part))
 	}
 
-	return fmt.Errorf("bsor read error: %v", err)
+	if e.Index >= 0 {
+		context = append(context, fmt.Sprintf("element %v", e.Index))
+	}
+
+	if e.Field != "" {
+		context = append(context, fmt.Sprintf("field %v", e.Field))
+	}
+
+	return fmt.Sprintf("%v at offset %v: %v", strings.Join(context, ", "), e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+type PartialReplayError struct {
+	Problems []*DecodeError
+}
+
+func (e *PartialReplayError) Error() string {
+	messages := make([]string, len(e.Problems))
+	for i := range e.Problems {
+		messages[i] = e.Problems[i].message()
+	}
+
+	return "bsor partial read: " + strings.Join(messages, "; ")
 }
 
 func clamp(value float64, min float64, max float64) float64 {
 	return math.Min(math.Max(min, value), max)
 }
 
-func Read(reader io.Reader) (*Replay, error) {
+// Read decodes the whole replay. With the Lenient option, decoding stops at the first broken
+// part and the replay decoded so far is returned together with a *PartialReplayError.
+func Read(r io.Reader, options ...ReadOption) (*Replay, error) {
+	opts := newReadOptions(options)
+
+	return readReplay(newDecodeReader(r, opts.limits), opts)
+}
+
+// ReadContext works like Read, but stops with the context error if ctx is cancelled. Cancellation is checked
+// between parts and periodically within them, so a read blocked on the underlying reader is not interrupted.
+func ReadContext(ctx context.Context, r io.Reader, options ...ReadOption) (*Replay, error) {
+	opts := newReadOptions(options)
+
+	reader := newDecodeReader(r, opts.limits)
+	reader.ctx = ctx
+
+	return readReplay(reader, opts)
+}
+
+// ReadBytes decodes the replay directly from the in-memory data, skipping the buffering of Read.
+// Custom data values share the memory with data, so data must not be modified afterwards.
+func ReadBytes(data []byte, options ...ReadOption) (*Replay, error) {
+	opts := newReadOptions(options)
+
+	return readReplay(newBytesDecodeReader(data, opts.limits), opts)
+}
+
+func readReplay(reader *decodeReader, opts *readOptions) (*Replay, error) {
 	var replay Replay
+	var problems []*DecodeError
 	var err error
 
+	reader.progress = opts.progress
+	partReader := &PartReader{reader: reader}
+
 	if err = readHeader(reader, &replay.Header); err != nil {
-		return nil, wrapError(err)
+		return nil, reader.decodeError(UnknownPart, -1, err)
 	}
 
 	for {
 		var partType PartType
 		if partType, err = readPartType(reader); err != nil {
 			if err == io.EOF {
-				return &replay, nil
+				if reader.progress != nil {
+					reader.progress(Progress{Bytes: reader.offset, Part: UnknownPart, Done: true})
+				}
+
+				return partialReplay(&replay, problems)
 			}
 
-			return nil, wrapError(err)
+			decodeErr := reader.decodeError(UnknownPart, -1, err)
+			if !opts.lenient {
+				return nil, decodeErr
+			}
+
+			problems = append(problems, decodeErr)
+
+			return partialReplay(&replay, problems)
 		}
 
-		switch partType {
-		case InfoPart:
-			err = readInfo(reader, &replay.Info)
+		if err = reader.checkpoint(partType); err != nil {
+			return nil, reader.decodeError(partType, -1, err)
+		}
 
-		case FramesPart:
-			err = readWholeSlice(reader, &replay.Frames)
+		if decode, found := lookupPartDecoder(replay.Version, partType); found {
+			err = decode(partReader, &replay)
+		} else {
+			err = reader.fieldAt("partType", reader.offset-1).fieldError(ErrUnknownPart)
+		}
 
-		case NotesPart:
-			err = readNotes(reader, &replay.Notes)
+		// the part has started, so running out of data in the middle of it is never a clean end
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
 
-		case WallsPart:
-			err = readWalls(reader, &replay.Walls)
+		if err != nil {
+			decodeErr := reader.decodeError(partType, replay.decodedCount(partType), err)
+			if !opts.lenient || reader.cancelled() {
+				return nil, decodeErr
+			}
 
-		case HeightsPart:
-			err = readWholeSlice(reader, &replay.Heights)
+			problems = append(problems, decodeErr)
 
-		case PausesPart:
-			err = readWholeSlice(reader, &replay.Pauses)
+			// invalid field value does not break the stream, the rest of the replay is still readable
+			if errors.Is(err, ErrDecodeField) {
+				continue
+			}
 
-		default:
-			return nil, wrapError(ErrUnknownPart)
+			return partialReplay(&replay, problems)
 		}
+	}
+}
 
-		if err != nil {
-			return nil, wrapError(err)
-		}
+func partialReplay(replay *Replay, problems []*DecodeError) (*Replay, error) {
+	if len(problems) > 0 {
+		return replay, &PartialReplayError{Problems: problems}
+	}
 
-		if partType == PausesPart {
-			return &replay, nil
-		}
+	return replay, nil
+}
+
+func (replay *Replay) decodedCount(partType PartType) int {
+	switch partType {
+	case FramesPart:
+		return sliceCount(replay.Frames)
+	case NotesPart:
+		return sliceCount(replay.Notes)
+	case WallsPart:
+		return sliceCount(replay.Walls)
+	case HeightsPart:
+		return sliceCount(replay.Heights)
+	case PausesPart:
+		return sliceCount(replay.Pauses)
+	case CustomDataPart:
+		return sliceCount(replay.CustomData)
+	default:
+		return -1
 	}
 }
 
-func readPartType(reader io.Reader) (PartType, error) {
-	partBytes, err := readBytes(reader, 1)
+// returns -1 if the slice was not even allocated, i.e. element count could not be read
+func sliceCount[T any](slice []T) int {
+	if slice == nil {
+		return -1
+	}
+
+	return len(slice)
+}
+
+// ReadInfo decodes the header and the info part only, the rest of the replay is not read.
+func ReadInfo(r io.Reader, options ...ReadOption) (*Header, *Info, error) {
+	opts := newReadOptions(options)
+	reader := newDecodeReader(r, opts.limits)
+
+	var replay Replay
+
+	if err := readHeader(reader, &replay.Header); err != nil {
+		return nil, nil, reader.decodeError(UnknownPart, -1, err)
+	}
+
+	partType, err := readPartType(reader)
 	if err != nil {
-		return 0, err
+		return nil, nil, reader.decodeError(UnknownPart, -1, err)
 	}
 
-	return PartType(partBytes[0]), nil
+	decode, found := lookupPartDecoder(replay.Version, InfoPart)
+	if partType != InfoPart || !found {
+		return nil, nil, reader.decodeError(partType, -1, ErrUnknownPart)
+	}
+
+	if err = decode(&PartReader{reader: reader}, &replay); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, nil, reader.decodeError(InfoPart, -1, err)
+	}
+
+	return &replay.Header, &replay.Info, nil
+}
+
+func readPartType(reader *decodeReader) (PartType, error) {
+	partType, err := reader.field("partType").readByte()
+
+	return PartType(partType), err
 }
 
-func readHeader(reader io.Reader, header *Header) error {
-	if err := readAny(reader, header); err != nil {
+func readHeader(reader *decodeReader, header *Header) error {
+	var err error
+	if header.Magic, err = readBsorInt(reader.field("magic")); err != nil {
+		return err
+	}
+
+	if header.Magic != bsorMagic {
+		return reader.fieldError(ErrNotBsorFile)
+	}
+
+	if header.Version, err = reader.field("version").readByte(); err != nil {
 		return err
 	}
 
-	if header.Magic != 0x442d3d69 {
-		return ErrNotBsorFile
+	if !isVersionRegistered(header.Version) {
+		return reader.fieldError(ErrUnknownBsorVersion)
 	}
 
-	if header.Version != 1 {
-		return ErrUnknownBsorVersion
+	return nil
+}
+
+// readBuiltinHeader accepts only the version whose layout is known without the registry
+func readBuiltinHeader(reader *decodeReader, header *Header) error {
+	if err := readHeader(reader, header); err != nil {
+		return err
+	}
+
+	if header.Version != BuiltinVersion {
+		return reader.fieldError(ErrUnknownBsorVersion)
 	}
 
 	return nil
 }
 
-func readInfo(reader io.Reader, info *Info) (err error) {
-	if info.ModVersion, err = readString(reader); err != nil {
+func readInfo(reader *decodeReader, info *Info) (err error) {
+	if info.ModVersion, err = readString(reader.field("modVersion")); err != nil {
 		return err
 	}
 
-	if info.GameVersion, err = readString(reader); err != nil {
+	if info.GameVersion, err = readString(reader.field("gameVersion")); err != nil {
 		return err
 	}
 
 	var str string
-	if str, err = readString(reader); err != nil {
+	if str, err = readString(reader.field("timeSet")); err != nil {
 		return err
 	}
-	timestampInt, err := strconv.Atoi(str)
-	if err != nil {
-		return ErrDecodeField
+	// invalid timestamp is reported after the whole part is read so the stream stays in sync
+	var timeSetErr error
+	if timestampInt, err := strconv.Atoi(str); err == nil {
+		info.TimeSet = time.Unix(int64(timestampInt), 0)
+	} else {
+		timeSetErr = reader.fieldError(ErrDecodeField)
 	}
-	info.TimeSet = time.Unix(int64(timestampInt), 0)
 
-	if info.PlayerId, err = readString(reader); err != nil {
+	if info.PlayerId, err = readString(reader.field("playerId")); err != nil {
 		return err
 	}
 
-	if info.PlayerName, err = readPotentiallyInvalidString(reader); err != nil {
+	if info.PlayerName, err = readPotentiallyInvalidString(reader.field("playerName")); err != nil {
 		return err
 	}
 
-	if info.Platform, err = readString(reader); err != nil {
+	if info.Platform, err = readString(reader.field("platform")); err != nil {
 		return err
 	}
 
-	if info.TrackingSystem, err = readString(reader); err != nil {
+	if info.TrackingSystem, err = readString(reader.field("trackingSystem")); err != nil {
 		return err
 	}
 
-	if info.Hmd, err = readString(reader); err != nil {
+	if info.Hmd, err = readString(reader.field("hmd")); err != nil {
 		return err
 	}
 
-	if info.Controller, err = readString(reader); err != nil {
+	if info.Controller, err = readString(reader.field("controller")); err != nil {
 		return err
 	}
 
-	if info.Hash, err = readString(reader); err != nil {
+	if info.Hash, err = readString(reader.field("hash")); err != nil {
 		return err
 	}
 
-	if info.SongName, err = readPotentiallyInvalidString(reader); err != nil {
+	if info.SongName, err = readPotentiallyInvalidString(reader.field("songName")); err != nil {
 		return err
 	}
 
-	if info.Mapper, err = readPotentiallyInvalidString(reader); err != nil {
+	if info.Mapper, err = readPotentiallyInvalidString(reader.field("mapper")); err != nil {
 		return err
 	}
 
-	if info.Difficulty, err = readString(reader); err != nil {
+	if info.Difficulty, err = readString(reader.field("difficulty")); err != nil {
 		return err
 	}
 
-	if err = readAny(reader, &info.Score); err != nil {
+	if info.Score, err = readBsorInt(reader.field("score")); err != nil {
 		return err
 	}
 
-	if info.Mode, err = readString(reader); err != nil {
+	if info.Mode, err = readString(reader.field("mode")); err != nil {
 		return err
 	}
 
-	if info.Environment, err = readString(reader); err != nil {
+	if info.Environment, err = readString(reader.field("environment")); err != nil {
 		return err
 	}
 
 	var modifiersCsv string
-	if modifiersCsv, err = readString(reader); err != nil {
+	if modifiersCsv, err = readString(reader.field("modifiers")); err != nil {
 		return err
 	}
-	modifiers := strings.Split(modifiersCsv, ",")
-	if len(modifiers) > 1 || len(modifiers[0]) > 0 {
-		info.Modifiers = modifiers
-	} else {
-		info.Modifiers = []Modifier{}
-	}
+	info.Modifiers = ParseModifiers(modifiersCsv)
 
-	if err = readAny(reader, &info.JumpDistance); err != nil {
+	if info.JumpDistance, err = reader.field("jumpDistance").readFloat(); err != nil {
 		return err
 	}
 
-	if err = readAny(reader, &info.LeftHanded); err != nil {
+	if info.LeftHanded, err = reader.field("leftHanded").readBool(); err != nil {
 		return err
 	}
 
-	if err = readAny(reader, &info.Height); err != nil {
+	if info.Height, err = reader.field("height").readFloat(); err != nil {
 		return err
 	}
 
-	if err = readAny(reader, &info.StartTime); err != nil {
+	if info.StartTime, err = reader.field("startTime").readFloat(); err != nil {
 		return err
 	}
 
-	if err = readAny(reader, &info.FailTime); err != nil {
+	if info.FailTime, err = reader.field("failTime").readFloat(); err != nil {
 		return err
 	}
 
-	if err = readAny(reader, &info.Speed); err != nil {
+	if info.Speed, err = reader.field("speed").readFloat(); err != nil {
 		return err
 	}
 
-	return nil
+	return timeSetErr
 }
 
-func readWholeSlice[T any](reader io.Reader, slice *[]T) (err error) {
-	var sliceLength ReplayInt
-	if sliceLength, err = readBsorInt(reader); err != nil {
+func readWholeSlice[T any](reader *decodeReader, partType PartType, slice *[]T, elementSize int, decode func([]byte, *T)) (err error) {
+	var sliceLength int
+	if sliceLength, err = readPartCount(reader, partType); err != nil {
 		return
 	}
 
-	*slice = make([]T, sliceLength)
+	dataOffset := reader.offset
+
+	// memory is allocated only for elements actually present in the file,
+	// so a truncated part still yields all elements read before
+	*slice = make([]T, 0, initialCapacity(sliceLength))
+	for i := 0; i < sliceLength; i++ {
+		if i > 0 && i%checkpointInterval == 0 {
+			if err = reader.checkpoint(partType); err != nil {
+				return
+			}
+		}
+
+		var data []byte
+		if data, err = reader.next(elementSize); err != nil {
+			reader.fieldAt("", dataOffset+int64(i*elementSize))
+
+			return
+		}
+
+		*slice = append(growCapacity(*slice, sliceLength), *new(T))
+		decode(data, &(*slice)[i])
+	}
 
-	return readAny(reader, slice)
+	return
+}
+
+// initialCapacity limits preallocation for counts declared in the file, which can not be trusted
+func initialCapacity(count int) int {
+	const maxInitialCapacity = 4096
+
+	if count > maxInitialCapacity {
+		return maxInitialCapacity
+	}
+
+	return count
+}
+
+// growCapacity doubles capacity of the full slice up to the declared count, append grows
+// large slices by a much smaller factor, which means many more reallocations and copies
+func growCapacity[T any](slice []T, count int) []T {
+	if len(slice) < cap(slice) {
+		return slice
+	}
+
+	capacity := 2 * cap(slice)
+	if capacity > count {
+		capacity = count
+	}
+
+	grown := make([]T, len(slice), capacity)
+	copy(grown, slice)
+
+	return grown
 }
 
-func readNotes(reader io.Reader, notes *[]Note) (err error) {
-	var notesCount ReplayInt
-	if notesCount, err = readBsorInt(reader); err != nil {
+func readNotes(reader *decodeReader, notes *[]Note) (err error) {
+	var notesCount int
+	if notesCount, err = readPartCount(reader, NotesPart); err != nil {
 		return
 	}
 
-	*notes = make([]Note, notesCount)
-	for i := range *notes {
-		var noteId ReplayInt
-		if noteId, err = readBsorInt(reader); err != nil {
-			return
+	*notes = make([]Note, 0, initialCapacity(notesCount))
+	for i := 0; i < notesCount; i++ {
+		if i > 0 && i%checkpointInterval == 0 {
+			if err = reader.checkpoint(NotesPart); err != nil {
+				return
+			}
 		}
 
-		(*notes)[i].ScoringType = NoteScoringType(noteId / 10000)
-		noteId = noteId % 10000
-		(*notes)[i].LineIdx = LineValue(noteId / 1000)
-		noteId = noteId % 1000
-		(*notes)[i].LineLayer = LayerValue(noteId / 100)
-		noteId = noteId % 100
-		(*notes)[i].ColorType = ColorType(noteId / 10)
-		noteId = noteId % 10
-		(*notes)[i].CutDirection = CutDirection(noteId)
-
-		if err = readAny(reader, &(*notes)[i].EventTime); err != nil {
-			return
-		}
-		if err = readAny(reader, &(*notes)[i].SpawnTime); err != nil {
-			return
-		}
-		if err = readAny(reader, &(*notes)[i].EventType); err != nil {
+		// decoded in place, the note is dropped if it's incomplete
+		*notes = append(growCapacity(*notes, notesCount), Note{})
+		if err = readNote(reader, &(*notes)[i]); err != nil {
+			*notes = (*notes)[:i]
+
 			return
 		}
-		if (*notes)[i].EventType == Good || (*notes)[i].EventType == Bad {
-			if err = readAny(reader, &(*notes)[i].CutInfo); err != nil {
-				return
-			}
-		}
 	}
 
 	return
 }
 
-func readWalls(reader io.Reader, walls *[]WallHit) (err error) {
-	var wallsCount ReplayInt
-	if wallsCount, err = readBsorInt(reader); err != nil {
+func readNote(reader *decodeReader, note *Note) (err error) {
+	var noteId ReplayInt
+	if noteId, err = readBsorInt(reader.field("noteId")); err != nil {
 		return
 	}
 
-	*walls = make([]WallHit, wallsCount)
-	for i := range *walls {
-		var wallId ReplayInt
-		if wallId, err = readBsorInt(reader); err != nil {
-			return
-		}
-		(*walls)[i].LineIdx = LineValue(wallId / 100)
-		wallId = wallId % 100
-		(*walls)[i].ObstacleType = byte(wallId / 10)
-		wallId = wallId % 10
-		(*walls)[i].Width = byte(wallId)
+	note.ScoringType = NoteScoringType(noteId / 10000)
+	noteId = noteId % 10000
+	note.LineIdx = LineValue(noteId / 1000)
+	noteId = noteId % 1000
+	note.LineLayer = LayerValue(noteId / 100)
+	noteId = noteId % 100
+	note.ColorType = ColorType(noteId / 10)
+	noteId = noteId % 10
+	note.CutDirection = CutDirection(noteId)
 
-		if err = readAny(reader, &(*walls)[i].Energy); err != nil {
+	if note.EventTime, err = reader.field("eventTime").readFloat(); err != nil {
+		return
+	}
+	if note.SpawnTime, err = reader.field("spawnTime").readFloat(); err != nil {
+		return
+	}
+	var eventType ReplayInt
+	if eventType, err = readBsorInt(reader.field("eventType")); err != nil {
+		return
+	}
+	note.EventType = NoteEventType(eventType)
+	if note.EventType == Good || note.EventType == Bad {
+		if err = readElement(reader.field("cutInfo"), noteCutInfoSize, decodeNoteCutInfo, &note.CutInfo); err != nil {
 			return
 		}
-		if err = readAny(reader, &(*walls)[i].Time); err != nil {
+	}
+
+	return
+}
+
+func readWalls(reader *decodeReader, walls *[]WallHit) (err error) {
+	var wallsCount int
+	if wallsCount, err = readPartCount(reader, WallsPart); err != nil {
+		return
+	}
+
+	*walls = make([]WallHit, 0, initialCapacity(wallsCount))
+	for i := 0; i < wallsCount; i++ {
+		var wall WallHit
+		if err = readWall(reader, &wall); err != nil {
 			return
 		}
-		if err = readAny(reader, &(*walls)[i].SpawnTime); err != nil {
+
+		*walls = append(*walls, wall)
+	}
+
+	return
+}
+
+func readWall(reader *decodeReader, wall *WallHit) (err error) {
+	var wallId ReplayInt
+	if wallId, err = readBsorInt(reader.field("wallId")); err != nil {
+		return
+	}
+	wall.LineIdx = LineValue(wallId / 100)
+	wallId = wallId % 100
+	wall.ObstacleType = byte(wallId / 10)
+	wallId = wallId % 10
+	wall.Width = byte(wallId)
+
+	if wall.Energy, err = reader.field("energy").readFloat(); err != nil {
+		return
+	}
+	if wall.Time, err = reader.field("time").readFloat(); err != nil {
+		return
+	}
+	if wall.SpawnTime, err = reader.field("spawnTime").readFloat(); err != nil {
+		return
+	}
+
+	return
+}
+
+func readCustomData(reader *decodeReader, customData *[]CustomData) (err error) {
+	var entriesCount int
+	if entriesCount, err = readPartCount(reader, CustomDataPart); err != nil {
+		return
+	}
+
+	*customData = make([]CustomData, 0, initialCapacity(entriesCount))
+	for i := 0; i < entriesCount; i++ {
+		var entry CustomData
+		if err = readCustomDataEntry(reader, &entry); err != nil {
 			return
 		}
+
+		*customData = append(*customData, entry)
 	}
 
 	return
 }
 
-func readAny(reader io.Reader, out any) error {
-	return binary.Read(reader, binary.LittleEndian, out)
-}
+func readCustomDataEntry(reader *decodeReader, entry *CustomData) (err error) {
+	if entry.Key, err = readString(reader.field("key")); err != nil {
+		return
+	}
 
-func readBsorInt(reader io.Reader) (value ReplayInt, err error) {
-	var uintBytes = make([]byte, 4)
+	var valueLength ReplayInt
+	if valueLength, err = readBsorInt(reader.field("value")); err != nil {
+		return
+	}
 
-	if uintBytes, err = readBytes(reader, 4); err != nil {
-		return 0, err
+	if err = checkLength(reader, "custom data bytes", int(valueLength), reader.limits.MaxCustomDataLength); err != nil {
+		return reader.fieldError(err)
 	}
 
-	return ReplayInt(byteOrder.Uint32(uintBytes)), nil
+	entry.Value, err = readBytes(reader, int(valueLength))
+
+	return
 }
 
-func readStringWithLength(reader io.Reader, length int) (str string, err error) {
-	stringBytes, err := readBytes(reader, length)
+func readBsorInt(reader *decodeReader) (value ReplayInt, err error) {
+	uintValue, err := reader.readUint32()
+
+	return ReplayInt(uintValue), err
+}
+
+func readStringWithLength(reader *decodeReader, length int) (str string, err error) {
+	if err = checkLength(reader, "string bytes", length, reader.limits.MaxStringLength); err != nil {
+		return "", reader.fieldError(err)
+	}
+
+	stringBytes, err := reader.next(length)
 	if err != nil {
 		return "", err
 	}
@@ -606,27 +906,27 @@ func readStringWithLength(reader io.Reader, length int) (str string, err error)
 	return string(stringBytes), nil
 }
 
-func skipResidualsOfIncorrectPreviousStringLength(reader io.Reader, length int) (int, error) {
-	bytes := make([]byte, 4)
-	byteOrder.PutUint32(bytes[0:], uint32(length))
+func skipResidualsOfIncorrectPreviousStringLength(reader *decodeReader, length int) (int, error) {
+	// iterative, as hostile input could otherwise make the recursion arbitrarily deep
+	for length > 255 || length < 0 {
+		bytes := make([]byte, 4)
+		byteOrder.PutUint32(bytes[0:], uint32(length))
 
-	var b uint8
-	if err := binary.Read(reader, binary.LittleEndian, &b); err != nil {
-		return 0, err
-	}
+		b, err := reader.readByte()
+		if err != nil {
+			return 0, err
+		}
 
-	bytes = bytes[1:]
-	bytes = append(bytes, b)
+		bytes = bytes[1:]
+		bytes = append(bytes, b)
 
-	length = int(byteOrder.Uint32(bytes))
-	if length > 255 || length < 0 {
-		return skipResidualsOfIncorrectPreviousStringLength(reader, length)
+		length = int(byteOrder.Uint32(bytes))
 	}
 
 	return length, nil
 }
 
-func readPotentiallyInvalidStringWithLength(reader io.Reader, length int) (str string, err error) {
+func readPotentiallyInvalidStringWithLength(reader *decodeReader, length int) (str string, err error) {
 	if length > 255 || length < 0 {
 		if length, err = skipResidualsOfIncorrectPreviousStringLength(reader, length); err != nil {
 			return "", err
@@ -636,57 +936,38 @@ func readPotentiallyInvalidStringWithLength(reader io.Reader, length int) (str s
 	return readStringWithLength(reader, length)
 }
 
-func readPotentiallyInvalidString(reader io.Reader) (str string, err error) {
+func readPotentiallyInvalidString(reader *decodeReader) (str string, err error) {
+	if reader.exactStrings {
+		return readString(reader)
+	}
+
 	var length ReplayInt
 	if length, err = readBsorInt(reader); err != nil {
 		return "", err
 	}
 
-	readSeeker, implementsSeeker := interface{}(reader).(io.Seeker)
-
-	if implementsSeeker && length > 0 {
-		originalOffset, err := readSeeker.Seek(0, io.SeekCurrent)
-		if err != nil {
-			return readPotentiallyInvalidStringWithLength(reader, int(length))
-		}
-
-		if _, err = readSeeker.Seek(int64(length), io.SeekCurrent); err != nil {
-			return readPotentiallyInvalidStringWithLength(reader, int(length))
-		}
-
-		var nextPossibleLength ReplayInt
-
-		if nextPossibleLength, err = readBsorInt(reader); err != nil {
-			readSeeker.Seek(originalOffset, io.SeekStart)
-
-			return readPotentiallyInvalidStringWithLength(reader, int(length))
-		}
-
-		for nextPossibleLength < 0 || nextPossibleLength > 255 {
-			if _, err = readSeeker.Seek(-3, io.SeekCurrent); err != nil {
-				readSeeker.Seek(originalOffset, io.SeekStart)
+	// some strings are stored with incorrect length, so look ahead for the next valid length prefix
+	// to find out where the string really ends; peeking makes it work for non-seekable streams too
+	if length > 0 {
+		for {
+			nextLengthBytes, err := reader.peekAt(int(length), 4)
+			if err != nil {
+				break
+			}
 
-				return readPotentiallyInvalidStringWithLength(reader, int(length))
+			nextPossibleLength := ReplayInt(byteOrder.Uint32(nextLengthBytes))
+			if nextPossibleLength >= 0 && nextPossibleLength <= 255 {
+				return readStringWithLength(reader, int(length))
 			}
 
 			length++
-
-			if nextPossibleLength, err = readBsorInt(reader); err != nil {
-				readSeeker.Seek(originalOffset, io.SeekStart)
-
-				return readPotentiallyInvalidStringWithLength(reader, int(length))
-			}
 		}
-
-		readSeeker.Seek(int64(-length)-int64(binary.Size(nextPossibleLength)), io.SeekCurrent)
-
-		return readStringWithLength(reader, int(length))
 	}
 
 	return readPotentiallyInvalidStringWithLength(reader, int(length))
 }
 
-func readString(reader io.Reader) (str string, err error) {
+func readString(reader *decodeReader) (str string, err error) {
 	var length ReplayInt
 	if length, err = readBsorInt(reader); err != nil {
 		return "", err
@@ -695,12 +976,23 @@ func readString(reader io.Reader) (str string, err error) {
 	return readStringWithLength(reader, int(length))
 }
 
-func readBytes(reader io.Reader, number int) (data []byte, err error) {
-	bytes := make([]byte, number)
+func readBytes(reader *decodeReader, number int) (data []byte, err error) {
+	if number < 0 {
+		return nil, ErrInvalidLength
+	}
 
-	if _, err := io.ReadFull(reader, bytes); err != nil {
+	buffered, err := reader.next(number)
+	if err != nil {
 		return nil, err
 	}
 
+	// in-memory data is not reused by the reader, so it can be returned as it is
+	if reader.inMemory {
+		return buffered, nil
+	}
+
+	bytes := make([]byte, number)
+	copy(bytes, buffered)
+
 	return bytes, nil
 }
@@ -0,0 +1,100 @@
+package bsor
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// FuzzRead checks that no way of decoding panics on arbitrary input, seeds are in testdata/fuzz/FuzzRead
+func FuzzRead(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _ = Read(bytes.NewReader(data))
+		_, _ = Read(bytes.NewReader(data), Lenient())
+		_, _ = ReadBytes(data)
+		_, _ = ReadBytes(data, Lenient())
+		_, _, _ = ReadInfo(bytes.NewReader(data))
+		_, _ = Index(bytes.NewReader(data))
+		_, _ = Unarchive(bytes.NewReader(data))
+
+		_ = NewDecoder(bytes.NewReader(data)).
+			OnInfo(func(Info) error { return nil }).
+			OnFrame(func(Frame) error { return nil }).
+			OnNote(func(Note) error { return nil }).
+			OnWall(func(WallHit) error { return nil }).
+			OnHeight(func(AutomaticHeight) error { return nil }).
+			OnPause(func(Pause) error { return nil }).
+			OnControllerOffsets(func(ControllerOffsets) error { return nil }).
+			OnCustomData(func(CustomData) error { return nil }).
+			Decode()
+
+		_ = NewDecoder(bytes.NewReader(data)).
+			Skip(InfoPart, FramesPart, NotesPart, WallsPart, HeightsPart, PausesPart, ControllerOffsetsPart, CustomDataPart).
+			Decode()
+	})
+}
+
+func TestLenientInvalidCount(t *testing.T) {
+	data := writeReplay(t, testReplay(100))
+
+	index, err := Index(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, part := range index.Parts {
+		if part.Type == HeightsPart {
+			// the count is right before the first element
+			byteOrder.PutUint32(data[part.Offset-4:], 0xffffffff)
+		}
+	}
+
+	replay, err := Read(bytes.NewReader(data), Lenient())
+
+	var partialErr *PartialReplayError
+	if !errors.As(err, &partialErr) {
+		t.Fatalf("got %v, want %T", err, partialErr)
+	}
+
+	// elements after the invalid count can not be located, so decoding stops there
+	if len(partialErr.Problems) != 1 || partialErr.Problems[0].Part != HeightsPart || !errors.Is(partialErr.Problems[0], ErrInvalidLength) {
+		t.Errorf("got problems %v, want only invalid heights count", partialErr.Problems)
+	}
+
+	if len(replay.Walls) != 1 || replay.Pauses != nil {
+		t.Errorf("got %v walls and %v pauses, want 1 wall and no pauses", len(replay.Walls), replay.Pauses)
+	}
+}
+
+// benchmarkData returns a few minutes long replay, frames make up most of it
+func benchmarkData(b *testing.B) []byte {
+	return writeReplay(b, testReplay(20000))
+}
+
+func BenchmarkRead(b *testing.B) {
+	data := benchmarkData(b)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := Read(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadBytes(b *testing.B) {
+	data := benchmarkData(b)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := ReadBytes(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package bsor
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var ErrZipArchive = Error{"zip archive can not be read as a single replay"}
+
+type Compression byte
+
+const (
+	NoCompression Compression = iota
+	GzipCompression
+	ZstdCompression
+	ZipArchive
+)
+
+func (s Compression) String() string {
+	switch s {
+	case NoCompression:
+		return "None"
+	case GzipCompression:
+		return "Gzip"
+	case ZstdCompression:
+		return "Zstd"
+	case ZipArchive:
+		return "Zip"
+	default:
+		return "Unknown"
+	}
+}
+
+var gzipMagic = []byte{0x1f, 0x8b}
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+var zipMagic = []byte{0x50, 0x4b, 0x03, 0x04}
+
+// ArchivedReplay is a replay read from a zip archive entry or a file of fs.FS. Entries which failed
+// to decode have Err set, so one broken entry does not prevent reading the others.
+type ArchivedReplay struct {
+	Name   string
+	Replay *Replay
+	Err    error
+}
+
+func DetectCompression(magic []byte) Compression {
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return GzipCompression
+	case bytes.HasPrefix(magic, zstdMagic):
+		return ZstdCompression
+	case bytes.HasPrefix(magic, zipMagic):
+		return ZipArchive
+	default:
+		return NoCompression
+	}
+}
+
+// Decompress sniffs the magic bytes of the stream and returns a reader of raw BSOR data,
+// transparently decompressing gzip and zstd streams. Zip archives need random access,
+// so ErrZipArchive is returned for them, use ReadZip or ReadFile instead.
+func Decompress(reader io.Reader) (io.ReadCloser, error) {
+	// raw seekable readers are returned as they are, so the decoder can still use seeking
+	if readSeeker, implementsSeeker := reader.(io.ReadSeeker); implementsSeeker {
+		if compression, err := detectSeekableCompression(readSeeker); err == nil && compression == NoCompression {
+			return nopReadSeekCloser{readSeeker}, nil
+		}
+	}
+
+	bufferedReader := bufio.NewReader(reader)
+
+	// Peek returns fewer bytes for short streams, which is fine as they can't be compressed anyway
+	magic, _ := bufferedReader.Peek(len(zstdMagic))
+
+	switch DetectCompression(magic) {
+	case GzipCompression:
+		return gzip.NewReader(bufferedReader)
+
+	case ZstdCompression:
+		decoder, err := zstd.NewReader(bufferedReader)
+		if err != nil {
+			return nil, err
+		}
+
+		return decoder.IOReadCloser(), nil
+
+	case ZipArchive:
+		return nil, ErrZipArchive
+
+	default:
+		return io.NopCloser(bufferedReader), nil
+	}
+}
+
+type nopReadSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopReadSeekCloser) Close() error { return nil }
+
+func detectSeekableCompression(readSeeker io.ReadSeeker) (Compression, error) {
+	start, err := readSeeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return NoCompression, err
+	}
+
+	magic := make([]byte, len(zstdMagic))
+	read, err := io.ReadFull(readSeeker, magic)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return NoCompression, err
+	}
+
+	if _, err = readSeeker.Seek(start, io.SeekStart); err != nil {
+		return NoCompression, err
+	}
+
+	return DetectCompression(magic[:read]), nil
+}
+
+// ReadCompressed reads raw, gzip or zstd compressed replay.
+func ReadCompressed(reader io.Reader, options ...ReadOption) (*Replay, error) {
+	decompressed, err := Decompress(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	defer decompressed.Close()
+
+	return Read(decompressed, options...)
+}
+
+// ReadZip reads every .bsor entry (optionally gzip or zstd compressed) of the zip archive.
+func ReadZip(readerAt io.ReaderAt, size int64, options ...ReadOption) ([]ArchivedReplay, error) {
+	archive, err := zip.NewReader(readerAt, size)
+	if err != nil {
+		return nil, err
+	}
+
+	replays := make([]ArchivedReplay, 0, len(archive.File))
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() || !isReplayFileName(file.Name) {
+			continue
+		}
+
+		replay := ArchivedReplay{Name: file.Name}
+		replay.Replay, replay.Err = readZipEntry(file, options)
+
+		replays = append(replays, replay)
+	}
+
+	return replays, nil
+}
+
+func readZipEntry(file *zip.File, options []ReadOption) (*Replay, error) {
+	entry, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer entry.Close()
+
+	return ReadCompressed(entry, options...)
+}
+
+func isReplayFileName(name string) bool {
+	name = strings.ToLower(path.Base(name))
+
+	return strings.HasSuffix(name, ".bsor") ||
+		strings.HasSuffix(name, ".bsor.gz") ||
+		strings.HasSuffix(name, ".bsor.zst")
+}
+
+// ReadFile reads a raw, gzip or zstd compressed replay or all replays from a zip archive.
+// Single replay files always yield exactly one ArchivedReplay named after the file.
+func ReadFile(name string, options ...ReadOption) ([]ArchivedReplay, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	compression, err := detectSeekableCompression(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if compression == ZipArchive {
+		var info os.FileInfo
+		if info, err = file.Stat(); err != nil {
+			return nil, err
+		}
+
+		return ReadZip(file, info.Size(), options...)
+	}
+
+	replay, err := ReadCompressed(file, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return []ArchivedReplay{{Name: filepath.Base(name), Replay: replay}}, nil
+}
@@ -0,0 +1,180 @@
+package bsor
+
+import "math"
+
+// the longest run of frames replaced by interpolation, it bounds the cost of error checking
+const maxKeyframeGap = 256
+
+// frame times are float32 sums, without some slack 30 fps would often mean every 4th frame of 90 fps
+const frameTimeSlack = 1e-4
+
+type DecimateOption func(*decimateOptions)
+
+type decimateOptions struct {
+	maxRate           float64
+	errorBound        bool
+	positionTolerance float64
+	rotationTolerance float64
+	positionStep      float64
+	rotationBits      int
+}
+
+// MaxFrameRate keeps at most the given number of frames per second.
+func MaxFrameRate(fps float64) DecimateOption {
+	return func(opts *decimateOptions) {
+		opts.maxRate = fps
+	}
+}
+
+// MaxError drops frames which can be interpolated from the kept ones with an error of up to
+// the given distance in meters and angle in radians, for the head and both hands.
+func MaxError(position float64, rotation float64) DecimateOption {
+	return func(opts *decimateOptions) {
+		opts.errorBound = true
+		opts.positionTolerance = position
+		opts.rotationTolerance = rotation
+	}
+}
+
+// QuantizePositions rounds positions of kept frames to multiples of step meters.
+func QuantizePositions(step float64) DecimateOption {
+	return func(opts *decimateOptions) {
+		opts.positionStep = step
+	}
+}
+
+// QuantizeRotations rounds every rotation component of kept frames to one of 2^bits-1 levels between -1 and 1.
+func QuantizeRotations(bits int) DecimateOption {
+	return func(opts *decimateOptions) {
+		opts.rotationBits = bits
+	}
+}
+
+// Decimate returns a copy of the replay with fewer, optionally quantized frames, for previews.
+// Without options all the frames are kept. MaxError keeps the error bound unless it would require
+// frames more often than MaxFrameRate allows. The first and last frame and frames around pauses
+// are always kept. Everything but frames is shared with the original replay.
+func Decimate(replay *Replay, options ...DecimateOption) *Replay {
+	opts := &decimateOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	decimated := *replay
+	decimated.Frames = make([]Frame, 0, initialCapacity(len(replay.Frames)))
+
+	for _, idx := range keyframes(replay.Frames, replay.Pauses, opts) {
+		frame := replay.Frames[idx]
+
+		for _, pose := range []*PositionAndRotation{&frame.Head, &frame.LeftHand, &frame.RightHand} {
+			quantizePose(pose, opts)
+		}
+
+		decimated.Frames = append(decimated.Frames, frame)
+	}
+
+	return &decimated
+}
+
+func keyframes(frames []Frame, pauses []Pause, opts *decimateOptions) []int {
+	if len(frames) == 0 {
+		return nil
+	}
+
+	forced := forcedKeyframes(frames, pauses)
+
+	minInterval := 0.0
+	if opts.maxRate > 0 {
+		minInterval = 1/opts.maxRate - frameTimeSlack
+	}
+
+	last := len(frames) - 1
+	indexes := []int{0}
+	for previous := 0; previous < last; {
+		next := previous + 1
+		for next < last && !forced[next] && float64(frames[next].Time-frames[previous].Time) < minInterval {
+			next++
+		}
+
+		if opts.errorBound {
+			for end := next + 1; !forced[next] && end <= last && end-previous <= maxKeyframeGap; end++ {
+				if !interpolationFits(frames, previous, end, opts) {
+					break
+				}
+
+				next = end
+			}
+		}
+
+		indexes = append(indexes, next)
+		previous = next
+	}
+
+	return indexes
+}
+
+// forcedKeyframes marks the last frame and frames on both sides of pauses and of jumps back in time,
+// interpolation between them would be meaningless
+func forcedKeyframes(frames []Frame, pauses []Pause) []bool {
+	forced := make([]bool, len(frames))
+	forced[len(frames)-1] = true
+
+	for i := 0; i < len(frames)-1; i++ {
+		if frames[i+1].Time < frames[i].Time {
+			forced[i], forced[i+1] = true, true
+		}
+	}
+
+	for _, pause := range pauses {
+		for i := 0; i < len(frames)-1; i++ {
+			if frames[i].Time <= pause.Time && pause.Time < frames[i+1].Time {
+				forced[i], forced[i+1] = true, true
+			}
+		}
+	}
+
+	return forced
+}
+
+func interpolationFits(frames []Frame, start int, end int, opts *decimateOptions) bool {
+	first, last := &frames[start], &frames[end]
+	duration := float64(last.Time - first.Time)
+
+	for i := start + 1; i < end; i++ {
+		t := 0.0
+		if duration > 0 {
+			t = float64(frames[i].Time-first.Time) / duration
+		}
+
+		if !poseFits(&first.Head, &last.Head, &frames[i].Head, t, opts) ||
+			!poseFits(&first.LeftHand, &last.LeftHand, &frames[i].LeftHand, t, opts) ||
+			!poseFits(&first.RightHand, &last.RightHand, &frames[i].RightHand, t, opts) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func poseFits(a *PositionAndRotation, b *PositionAndRotation, actual *PositionAndRotation, t float64, opts *decimateOptions) bool {
+	interpolated := interpolatePose(a, b, t)
+
+	return positionDistance(interpolated.Position, actual.Position) <= opts.positionTolerance &&
+		rotationAngle(interpolated.Rotation, actual.Rotation) <= opts.rotationTolerance
+}
+
+func quantizePose(pose *PositionAndRotation, opts *decimateOptions) {
+	if opts.positionStep > 0 {
+		for _, value := range []*ReplayFloat{&pose.Position.X, &pose.Position.Y, &pose.Position.Z} {
+			*value = ReplayFloat(math.Round(float64(*value)/opts.positionStep) * opts.positionStep)
+		}
+	}
+
+	if opts.rotationBits > 1 && opts.rotationBits < 32 {
+		levels := float64(int64(1)<<(opts.rotationBits-1) - 1)
+
+		for _, value := range []*ReplayFloat{&pose.Rotation.X, &pose.Rotation.Y, &pose.Rotation.Z, &pose.Rotation.W} {
+			*value = ReplayFloat(math.Round(clamp(float64(*value), -1, 1)*levels) / levels)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package bsor
+
+import (
+	"errors"
+	"io"
+)
+
+var ErrStopDecoding = Error{"decoding stopped"}
+
+// encoded sizes of elements
+const frameSize = 92
+const heightSize = 8
+const pauseSize = 12
+const noteCutInfoSize = 72
+const controllerOffsetsSize = 56
+const wallSize = 16
+const minNoteSize = 16
+const minCustomDataSize = 8
+
+type handlerError struct {
+	err error
+}
+
+func (e handlerError) Error() string { return e.err.Error() }
+
+type Decoder struct {
+	reader              *decodeReader
+	onHeader            func(Header) error
+	onInfo              func(Info) error
+	onFrame             func(Frame) error
+	onNote              func(Note) error
+	onWall              func(WallHit) error
+	onHeight            func(AutomaticHeight) error
+	onPause             func(Pause) error
+	onControllerOffsets func(ControllerOffsets) error
+	onCustomData        func(CustomData) error
+	skippedParts        map[PartType]bool
+}
+
+// NewDecoder creates a decoder of replays of BuiltinVersion, versions added by RegisterVersion are not supported.
+func NewDecoder(reader io.Reader) *Decoder {
+	return &Decoder{reader: newDecodeReader(reader, DefaultLimits), skippedParts: map[PartType]bool{}}
+}
+
+func (decoder *Decoder) Limits(limits Limits) *Decoder {
+	decoder.reader.limits = limits
+
+	return decoder
+}
+
+func (decoder *Decoder) OnHeader(handler func(Header) error) *Decoder {
+	decoder.onHeader = handler
+
+	return decoder
+}
+
+func (decoder *Decoder) OnInfo(handler func(Info) error) *Decoder {
+	decoder.onInfo = handler
+
+	return decoder
+}
+
+func (decoder *Decoder) OnFrame(handler func(Frame) error) *Decoder {
+	decoder.onFrame = handler
+
+	return decoder
+}
+
+func (decoder *Decoder) OnNote(handler func(Note) error) *Decoder {
+	decoder.onNote = handler
+
+	return decoder
+}
+
+func (decoder *Decoder) OnWall(handler func(WallHit) error) *Decoder {
+	decoder.onWall = handler
+
+	return decoder
+}
+
+func (decoder *Decoder) OnHeight(handler func(AutomaticHeight) error) *Decoder {
+	decoder.onHeight = handler
+
+	return decoder
+}
+
+func (decoder *Decoder) OnPause(handler func(Pause) error) *Decoder {
+	decoder.onPause = handler
+
+	return decoder
+}
+
+func (decoder *Decoder) OnControllerOffsets(handler func(ControllerOffsets) error) *Decoder {
+	decoder.onControllerOffsets = handler
+
+	return decoder
+}
+
+func (decoder *Decoder) OnCustomData(handler func(CustomData) error) *Decoder {
+	decoder.onCustomData = handler
+
+	return decoder
+}
+
+// Skip makes the decoder jump over the given parts without decoding their elements.
+// Handlers registered for skipped parts are never called.
+func (decoder *Decoder) Skip(parts ...PartType) *Decoder {
+	for _, part := range parts {
+		decoder.skippedParts[part] = true
+	}
+
+	return decoder
+}
+
+// Decode reads the whole replay, calling registered handlers for every decoded element.
+// Returning ErrStopDecoding from a handler stops decoding without an error, any other
+// handler error is returned as is.
+func (decoder *Decoder) Decode() error {
+	err := decoder.decode()
+
+	var handlerErr handlerError
+	if errors.As(err, &handlerErr) {
+		if handlerErr.err == ErrStopDecoding {
+			return nil
+		}
+
+		return handlerErr.err
+	}
+
+	return err
+}
+
+func (decoder *Decoder) decode() (err error) {
+	reader := decoder.reader
+
+	var header Header
+	if err = readBuiltinHeader(reader, &header); err != nil {
+		return reader.decodeError(UnknownPart, -1, err)
+	}
+
+	if err = handle(decoder.onHeader, header); err != nil {
+		return err
+	}
+
+	for {
+		var partType PartType
+		if partType, err = readPartType(reader); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return reader.decodeError(UnknownPart, -1, err)
+		}
+
+		index := -1
+
+		if decoder.skippedParts[partType] {
+			err = skipPart(reader, partType)
+		} else {
+			switch partType {
+			case InfoPart:
+				var info Info
+				if err = readInfo(reader, &info); err == nil {
+					err = handle(decoder.onInfo, info)
+				}
+
+			case FramesPart:
+				index, err = decodeEach(reader, FramesPart, decoder.onFrame, readFrame)
+
+			case NotesPart:
+				index, err = decodeEach(reader, NotesPart, decoder.onNote, readNote)
+
+			case WallsPart:
+				index, err = decodeEach(reader, WallsPart, decoder.onWall, readWall)
+
+			case HeightsPart:
+				index, err = decodeEach(reader, HeightsPart, decoder.onHeight, readHeight)
+
+			case PausesPart:
+				index, err = decodeEach(reader, PausesPart, decoder.onPause, readPause)
+
+			case ControllerOffsetsPart:
+				var offsets ControllerOffsets
+				if err = readElement(reader.field(""), controllerOffsetsSize, decodeControllerOffsets, &offsets); err == nil {
+					err = handle(decoder.onControllerOffsets, offsets)
+				}
+
+			case CustomDataPart:
+				index, err = decodeEach(reader, CustomDataPart, decoder.onCustomData, readCustomDataEntry)
+
+			default:
+				err = reader.fieldAt("partType", reader.offset-1).fieldError(ErrUnknownPart)
+			}
+		}
+
+		if err != nil {
+			if _, isHandlerErr := err.(handlerError); isHandlerErr {
+				return err
+			}
+
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+
+			return reader.decodeError(partType, index, err)
+		}
+	}
+}
+
+func handle[T any](handler func(T) error, value T) error {
+	if handler == nil {
+		return nil
+	}
+
+	if err := handler(value); err != nil {
+		return handlerError{err}
+	}
+
+	return nil
+}
+
+// decodeEach returns index of the element that failed to decode, or -1 if the count itself could not be read
+func decodeEach[T any](reader *decodeReader, partType PartType, handler func(T) error, read func(*decodeReader, *T) error) (int, error) {
+	count, err := readPartCount(reader, partType)
+	if err != nil {
+		return -1, err
+	}
+
+	// single variable is reused, so elements passed to the handler don't escape to the heap one by one
+	var element T
+	for i := 0; i < count; i++ {
+		element = *new(T)
+		if err = read(reader, &element); err != nil {
+			return i, err
+		}
+
+		if err = handle(handler, element); err != nil {
+			return i, err
+		}
+	}
+
+	return -1, nil
+}
+
+func readFrame(reader *decodeReader, frame *Frame) error {
+	return readElement(reader.field(""), frameSize, decodeFrame, frame)
+}
+
+func readHeight(reader *decodeReader, height *AutomaticHeight) error {
+	return readElement(reader.field(""), heightSize, decodeHeight, height)
+}
+
+func readPause(reader *decodeReader, pause *Pause) error {
+	return readElement(reader.field(""), pauseSize, decodePause, pause)
+}
+
+func skipPart(reader *decodeReader, partType PartType) (err error) {
+	switch partType {
+	case InfoPart:
+		var info Info
+		return readInfo(reader, &info)
+
+	case ControllerOffsetsPart:
+		return skipBytes(reader, int64(controllerOffsetsSize))
+
+	case FramesPart, NotesPart, WallsPart, HeightsPart, PausesPart, CustomDataPart:
+		var count int
+		if count, err = readPartCount(reader, partType); err != nil {
+			return
+		}
+
+		return skipPartElements(reader, partType, count)
+
+	default:
+		return ErrUnknownPart
+	}
+}
+
+func skipPartElements(reader *decodeReader, partType PartType, count int) (err error) {
+	switch partType {
+	case FramesPart:
+		return skipElements(reader, count, frameSize)
+
+	case NotesPart:
+		for i := 0; i < count; i++ {
+			// note id, event time and spawn time
+			if err = skipBytes(reader, 12); err != nil {
+				return
+			}
+
+			var eventType ReplayInt
+			if eventType, err = readBsorInt(reader.field("eventType")); err != nil {
+				return
+			}
+
+			if NoteEventType(eventType) == Good || NoteEventType(eventType) == Bad {
+				if err = skipBytes(reader, int64(noteCutInfoSize)); err != nil {
+					return
+				}
+			}
+		}
+
+		return
+
+	case WallsPart:
+		return skipElements(reader, count, wallSize)
+
+	case HeightsPart:
+		return skipElements(reader, count, heightSize)
+
+	case PausesPart:
+		return skipElements(reader, count, pauseSize)
+
+	case CustomDataPart:
+		// every entry consists of a key string and a value byte array, both prefixed with length
+		for i := 0; i < count*2; i++ {
+			var length ReplayInt
+			if length, err = readBsorInt(reader); err != nil {
+				return
+			}
+
+			if err = skipBytes(reader, int64(length)); err != nil {
+				return
+			}
+		}
+
+		return
+
+	default:
+		return ErrUnknownPart
+	}
+}
+
+func skipElements(reader *decodeReader, count int, elementSize int) error {
+	return skipBytes(reader, int64(count)*int64(elementSize))
+}
+
+func skipBytes(reader *decodeReader, number int64) error {
+	if number < 0 {
+		return reader.fieldError(ErrInvalidLength)
+	}
+
+	return reader.skip(number)
+}
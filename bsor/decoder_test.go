@@ -0,0 +1,49 @@
+package bsor
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecoderSkipTruncated(t *testing.T) {
+	replay := testReplay(100)
+	replay.Notes, replay.Walls, replay.Heights, replay.Pauses, replay.ControllerOffsets, replay.CustomData = nil, nil, nil, nil, nil, nil
+
+	data := writeReplay(t, replay)
+
+	// the file ends in the middle of frames, past the buffered data so the skip seeks
+	truncated := data[:len(data)-20*frameSize]
+
+	file := filepath.Join(t.TempDir(), "truncated.bsor")
+	if err := os.WriteFile(file, truncated, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	readers := map[string]func() (io.Reader, error){
+		"bytes.Reader": func() (io.Reader, error) { return bytes.NewReader(truncated), nil },
+		"os.File":      func() (io.Reader, error) { return os.Open(file) },
+		"not seekable": func() (io.Reader, error) { return bytes.NewBuffer(truncated), nil },
+	}
+
+	for name, open := range readers {
+		t.Run(name, func(t *testing.T) {
+			reader, err := open()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if closer, ok := reader.(io.Closer); ok {
+				defer closer.Close()
+			}
+
+			err = NewDecoder(reader).Skip(FramesPart).Decode()
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("got %v, want %v", err, io.ErrUnexpectedEOF)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package bsor
+
+import "sort"
+
+// energy changes of the game, chain elements change it less than other notes
+const (
+	startEnergy               = 0.5
+	goodCutEnergy             = 0.01
+	badCutEnergy              = -0.1
+	missEnergy                = -0.15
+	bombEnergy                = -0.15
+	chainElementGoodCutEnergy = 0.002
+	chainElementBadCutEnergy  = -0.025
+	chainElementMissEnergy    = -0.03
+	fourLivesBatteries        = 4
+	oneLifeBatteries          = 1
+	energyZero                = 1e-5
+)
+
+type EnergyPoint struct {
+	Time     TimeValue   `json:"time"`
+	Energy   ReplayFloat `json:"energy"`
+	EventIdx Counter     `json:"eventIdx"`
+}
+
+// EnergyTimeline is the simulated energy bar, with a point after every event changing it.
+type EnergyTimeline struct {
+	Points        []EnergyPoint `json:"points"`
+	MinEnergy     ReplayFloat   `json:"minEnergy"`
+	MinEnergyTime TimeValue     `json:"minEnergyTime"`
+	// Failed is set if the energy reached zero at FailTime, with NoFail the play continued then
+	Failed   bool      `json:"failed"`
+	FailTime TimeValue `json:"failTime"`
+}
+
+// SimulateEnergy replays the energy bar over the chronological events, using the energy changes of the game.
+// Walls set the energy recorded in the replay. OneLife and FourLives modifiers switch to batteries which
+// lose a life on every error and never recharge. Once the energy reaches zero it does not change anymore,
+// which with NoFail lasts until the end of the play.
+func SimulateEnergy(events *ReplayEvents) *EnergyTimeline {
+	batteries := 0
+	switch {
+	case events.Info.HasModifier(OneLife):
+		batteries = oneLifeBatteries
+	case events.Info.HasModifier(FourLives):
+		batteries = fourLivesBatteries
+	}
+
+	energy := ReplayFloat(startEnergy)
+	if batteries > 0 {
+		energy = 1
+	}
+
+	gameEvents := events.gameEvents()
+
+	timeline := &EnergyTimeline{
+		Points:    make([]EnergyPoint, 0, len(gameEvents)+1),
+		MinEnergy: energy,
+	}
+
+	timeline.Points = append(timeline.Points, EnergyPoint{Time: 0, Energy: energy, EventIdx: -1})
+
+	for _, gameEvent := range gameEvents {
+		if timeline.Failed {
+			break
+		}
+
+		var change ReplayFloat
+
+		switch event := gameEvent.(type) {
+		case *WallHitEvent:
+			change = clampEnergy(event.Energy) - energy
+		default:
+			change = noteEnergyChange(gameEvent)
+		}
+
+		if change == 0 {
+			continue
+		}
+
+		if batteries > 0 {
+			if change > 0 {
+				continue
+			}
+
+			change = -1 / ReplayFloat(batteries)
+		}
+
+		energy = clampEnergy(energy + change)
+		if energy < energyZero {
+			energy = 0
+		}
+
+		time := gameEvent.GetTime()
+		timeline.Points = append(timeline.Points, EnergyPoint{Time: time, Energy: energy, EventIdx: gameEvent.GetIdx()})
+
+		if energy < timeline.MinEnergy {
+			timeline.MinEnergy, timeline.MinEnergyTime = energy, time
+		}
+
+		if energy == 0 {
+			timeline.Failed, timeline.FailTime = true, time
+		}
+	}
+
+	return timeline
+}
+
+// EnergyAt returns the energy right after all the events up to time t.
+func (timeline *EnergyTimeline) EnergyAt(t TimeValue) ReplayFloat {
+	idx := sort.Search(len(timeline.Points), func(i int) bool { return timeline.Points[i].Time > t })
+	if idx == 0 {
+		return timeline.Points[0].Energy
+	}
+
+	return timeline.Points[idx-1].Energy
+}
+
+func noteEnergyChange(gameEvent GameEventI) ReplayFloat {
+	switch event := gameEvent.(type) {
+	case *GoodNoteCutEvent:
+		if event.ScoringType == BurstSliderElement {
+			return chainElementGoodCutEnergy
+		}
+
+		return goodCutEnergy
+	case *BadCutEvent:
+		if event.ScoringType == BurstSliderElement {
+			return chainElementBadCutEnergy
+		}
+
+		return badCutEnergy
+	case *MissedNoteEvent:
+		if event.ScoringType == BurstSliderElement {
+			return chainElementMissEnergy
+		}
+
+		return missEnergy
+	case *BombHitEvent:
+		return bombEnergy
+	default:
+		return 0
+	}
+}
+
+func clampEnergy(energy ReplayFloat) ReplayFloat {
+	return ReplayFloat(clamp(float64(energy), 0, 1))
+}
+
+// gameEvents returns all the events in the chronological order
+func (events *ReplayEvents) gameEvents() []GameEventI {
+	gameEvents := make([]GameEventI, 0, len(events.Hits)+len(events.Misses)+len(events.BadCuts)+len(events.BombHits)+len(events.Walls))
+
+	for i := range events.Hits {
+		gameEvents = append(gameEvents, &events.Hits[i])
+	}
+
+	for i := range events.Misses {
+		gameEvents = append(gameEvents, &events.Misses[i])
+	}
+
+	for i := range events.BadCuts {
+		gameEvents = append(gameEvents, &events.BadCuts[i])
+	}
+
+	for i := range events.BombHits {
+		gameEvents = append(gameEvents, &events.BombHits[i])
+	}
+
+	for i := range events.Walls {
+		gameEvents = append(gameEvents, &events.Walls[i])
+	}
+
+	sort.SliceStable(gameEvents, func(i, j int) bool {
+		if gameEvents[i].GetTime() == gameEvents[j].GetTime() {
+			return gameEvents[i].GetIdx() < gameEvents[j].GetIdx()
+		}
+
+		return gameEvents[i].GetTime() < gameEvents[j].GetTime()
+	})
+
+	return gameEvents
+}
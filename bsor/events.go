@@ -109,7 +109,11 @@ func (gameEvent *GameEvent) GetScore() CutValue {
 }
 
 func (gameEvent *GameEvent) GetMaxScore() CutValue {
-	switch gameEvent.ScoringType {
+	return noteMaxScore(gameEvent.ScoringType)
+}
+
+func noteMaxScore(scoringType NoteScoringType) CutValue {
+	switch scoringType {
 	case BurstSliderHead:
 		return 85
 	case BurstSliderElement:
@@ -119,6 +123,20 @@ func (gameEvent *GameEvent) GetMaxScore() CutValue {
 	}
 }
 
+// MaxScore returns the max score of notes with the scoring types given in the order of time,
+// like all notes of a map.
+func MaxScore(scoringTypes []NoteScoringType) Score {
+	multiplier := NewMultiplierCounter()
+
+	var maxScore Score
+	for _, scoringType := range scoringTypes {
+		maxScore += Score(noteMaxScore(scoringType)) * Score(multiplier.Value())
+		multiplier.Inc()
+	}
+
+	return maxScore
+}
+
 func (gameEvent *GameEvent) DecreasesCombo() bool {
 	return gameEvent.EventType != Good
 }
@@ -275,6 +293,8 @@ type ReplayEventsInfo struct {
 	Info
 	EndTime       TimeValue  `json:"endTime"`
 	CalcScore     Score      `json:"calcScore"`
+	BaseScore     Score      `json:"baseScore"`
+	MaxScore      Score      `json:"maxScore"`
 	Accuracy      SwingValue `json:"accuracy"`
 	CalcAccuracy  SwingValue `json:"calcAccuracy"`
 	FcAccuracy    SwingValue `json:"fcAccuracy"`
@@ -298,7 +318,8 @@ type ReplayEventsWithStats struct {
 	Stats Stats `json:"stats"`
 }
 
-func calculateStats(events *ReplayEvents, gameEvents []GameEventI) {
+// calculateStats computes accuracies against mapMaxScore if it is known, or max score of the events otherwise
+func calculateStats(events *ReplayEvents, gameEvents []GameEventI, mapMaxScore Score) {
 	multiplier := NewMultiplierCounter()
 	maxMultiplier := NewMultiplierCounter()
 
@@ -410,23 +431,36 @@ func calculateStats(events *ReplayEvents, gameEvents []GameEventI) {
 		maxCombo = currentCombo
 	}
 
-	events.Info.CalcScore = score
+	fcMaxScore := maxScore
+	if mapMaxScore > 0 {
+		maxScore = mapMaxScore
+	}
+
+	events.Info.BaseScore = score
+	events.Info.CalcScore = modifiedScore(score, events.Info.Modifiers, events.Info.FailTime > 0)
+	events.Info.MaxScore = maxScore
 	events.Info.MaxCombo = maxCombo
 	events.Info.MaxLeftCombo = maxLeftCombo
 	events.Info.MaxRightCombo = maxRightCombo
 
 	if maxScore > 0 {
 		if score > 0 {
-			events.Info.CalcAccuracy = SwingValue(score) / SwingValue(maxScore) * 100
+			events.Info.CalcAccuracy = SwingValue(events.Info.CalcScore) / SwingValue(maxScore) * 100
 		} else {
 			events.Info.CalcAccuracy = SwingValue(events.Info.Score) / SwingValue(maxScore) * 100
 		}
-		events.Info.FcAccuracy = SwingValue(fcScore) / SwingValue(maxScore) * 100
+		events.Info.FcAccuracy = SwingValue(fcScore) / SwingValue(fcMaxScore) * 100
 		events.Info.Accuracy = SwingValue(events.Info.Score) / SwingValue(maxScore) * 100
 	}
 }
 
-func createReplayEvents(replay *Replay, fixReplayErrors bool) *ReplayEvents {
+// modifiedScore applies the modifiers multiplier in float32 and rounds down like the game, which multiplies
+// the whole score by the multiplier with NoFail penalty once the energy reached zero
+func modifiedScore(score Score, modifiers []Modifier, failed bool) Score {
+	return Score(math.Floor(float64(ReplayFloat(score) * ModifiersMultiplier(modifiers, failed))))
+}
+
+func createReplayEvents(replay *Replay, fixReplayErrors bool, mapMaxScore Score) *ReplayEvents {
 	hitsCnt := 0
 	missesCnt := 0
 	badCutsCnt := 0
@@ -529,16 +563,23 @@ func createReplayEvents(replay *Replay, fixReplayErrors bool) *ReplayEvents {
 		events.Info.EndTime = replay.Frames[len(replay.Frames)-1].Time
 	}
 
-	calculateStats(events, gameEvents)
+	calculateStats(events, gameEvents, mapMaxScore)
 
 	return events
 }
 
 func NewReplayEvents(replay *Replay) *ReplayEvents {
-	events := createReplayEvents(replay, false)
+	return NewReplayEventsWithMaxScore(replay, 0)
+}
+
+// NewReplayEventsWithMaxScore works like NewReplayEvents, but Accuracy and CalcAccuracy are computed against
+// the given max score, like the one of all the map notes, instead of notes recorded in the replay, which is
+// too low for failed or quit plays. FcAccuracy still covers recorded notes only. Zero max score is ignored.
+func NewReplayEventsWithMaxScore(replay *Replay, maxScore Score) *ReplayEvents {
+	events := createReplayEvents(replay, false, maxScore)
 
 	if events.Info.Score != events.Info.CalcScore {
-		events = createReplayEvents(replay, true)
+		events = createReplayEvents(replay, true, maxScore)
 	}
 
 	return events
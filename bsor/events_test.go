@@ -0,0 +1,45 @@
+package bsor
+
+import "testing"
+
+func TestCalcScoreWithModifiers(t *testing.T) {
+	// perfect cuts of 10 notes with the combo multiplier growing to 4 give 115 * (1 + 2*4 + 4*5)
+	const baseScore = 3335
+
+	tests := []struct {
+		name      string
+		modifiers []Modifier
+		failTime  TimeValue
+		score     Score
+	}{
+		{"no modifiers", []Modifier{}, 0, baseScore},
+		{"faster song and no fail after fail", []Modifier{FasterSong, NoFail}, 4.2, 1934},
+		{"no fail without fail", []Modifier{NoFail, GhostNotes}, 0, 3701},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			replay := &Replay{Header: Header{Magic: bsorMagic, Version: BuiltinVersion}}
+			replay.Info.Modifiers = test.modifiers
+			replay.Info.FailTime = test.failTime
+			replay.Info.Score = test.score
+
+			for i := 0; i < 10; i++ {
+				replay.Notes = append(replay.Notes, Note{
+					ScoringType: Normal,
+					LineIdx:     LineValue(i % 4),
+					EventTime:   TimeValue(i),
+					SpawnTime:   TimeValue(i),
+					EventType:   Good,
+					CutInfo:     NoteCutInfo{SpeedOk: true, DirectionOk: true, SaberTypeOk: true, BeforeCutRating: 1, AfterCutRating: 1},
+				})
+			}
+
+			events := NewReplayEvents(replay)
+
+			if events.Info.CalcScore != replay.Info.Score || events.Info.BaseScore != baseScore {
+				t.Errorf("got calculated score %v and base score %v, want %v and %v", events.Info.CalcScore, events.Info.BaseScore, replay.Info.Score, baseScore)
+			}
+		})
+	}
+}
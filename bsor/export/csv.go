@@ -0,0 +1,102 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"github.com/motzel/go-bsor/bsor"
+)
+
+// CSVWriter writes rows of many replays into a single CSV file with a header row.
+type CSVWriter struct {
+	writer        *csv.Writer
+	table         Table
+	options       *options
+	columns       []column
+	headerWritten bool
+	values        []value
+	record        []string
+}
+
+func NewCSVWriter(writer io.Writer, table Table, options ...Option) *CSVWriter {
+	opts := newOptions(options)
+	columns := table.columns(opts)
+
+	return &CSVWriter{
+		writer:  csv.NewWriter(writer),
+		table:   table,
+		options: opts,
+		columns: columns,
+		values:  make([]value, 0, len(columns)),
+		record:  make([]string, len(columns)),
+	}
+}
+
+func (w *CSVWriter) writeHeader() error {
+	if w.headerWritten {
+		return nil
+	}
+
+	w.headerWritten = true
+
+	for i, column := range w.columns {
+		w.record[i] = column.name
+	}
+
+	return w.writer.Write(w.record)
+}
+
+func (w *CSVWriter) Write(replay *bsor.Replay) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	for row := 0; row < w.table.rowsCount(replay); row++ {
+		w.values = w.table.row(replay, row, w.options, w.values[:0])
+
+		for i, column := range w.columns {
+			w.record[i] = formatValue(column.kind, w.values[i])
+		}
+
+		if err := w.writer.Write(w.record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Flush writes the header if no replay was written and flushes buffered rows.
+func (w *CSVWriter) Flush() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	w.writer.Flush()
+
+	return w.writer.Error()
+}
+
+func formatValue(kind kind, value value) string {
+	switch kind {
+	case floatKind:
+		return strconv.FormatFloat(float64(value.float), 'g', -1, 32)
+	case intKind:
+		return strconv.FormatInt(int64(value.int), 10)
+	case boolKind:
+		return strconv.FormatBool(value.bool)
+	default:
+		return value.str
+	}
+}
+
+// WriteCSV writes rows of a single replay.
+func WriteCSV(writer io.Writer, table Table, replay *bsor.Replay, options ...Option) error {
+	csvWriter := NewCSVWriter(writer, table, options...)
+	if err := csvWriter.Write(replay); err != nil {
+		return err
+	}
+
+	return csvWriter.Flush()
+}
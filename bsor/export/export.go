@@ -0,0 +1,220 @@
+package export
+
+import (
+	"github.com/motzel/go-bsor/bsor"
+)
+
+// Table selects which elements of the replay are exported, every element becomes one row.
+type Table byte
+
+const (
+	Frames Table = iota
+	Notes
+)
+
+func (s Table) String() string {
+	switch s {
+	case Frames:
+		return "Frames"
+	case Notes:
+		return "Notes"
+	default:
+		return "Unknown"
+	}
+}
+
+type Option func(*options)
+
+type options struct {
+	tags bool
+}
+
+// WithTags prepends hash, player_id and difficulty columns, so rows of many replays can be told apart.
+func WithTags() Option {
+	return func(opts *options) {
+		opts.tags = true
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, option := range opts {
+		option(o)
+	}
+
+	return o
+}
+
+type kind byte
+
+const (
+	floatKind kind = iota
+	intKind
+	boolKind
+	stringKind
+)
+
+type column struct {
+	name string
+	kind kind
+}
+
+type value struct {
+	float float32
+	int   int32
+	bool  bool
+	str   string
+}
+
+var tagColumns = []column{
+	{"hash", stringKind},
+	{"player_id", stringKind},
+	{"difficulty", stringKind},
+}
+
+var frameColumns = newFrameColumns()
+var noteColumns = newNoteColumns()
+
+func newFrameColumns() []column {
+	columns := []column{{"time", floatKind}, {"fps", intKind}}
+	for _, prefix := range []string{"head", "left_hand", "right_hand"} {
+		columns = append(columns, positionAndRotationColumns(prefix)...)
+	}
+
+	return columns
+}
+
+func newNoteColumns() []column {
+	columns := []column{
+		{"scoring_type", intKind},
+		{"line_idx", intKind},
+		{"line_layer", intKind},
+		{"color_type", intKind},
+		{"cut_direction", intKind},
+		{"event_time", floatKind},
+		{"spawn_time", floatKind},
+		{"event_type", intKind},
+		{"speed_ok", boolKind},
+		{"direction_ok", boolKind},
+		{"saber_type_ok", boolKind},
+		{"was_cut_too_soon", boolKind},
+		{"saber_speed", floatKind},
+	}
+	columns = append(columns, vector3Columns("saber_dir")...)
+	columns = append(columns, column{"saber_type", intKind}, column{"time_deviation", floatKind}, column{"cut_dir_deviation", floatKind})
+	columns = append(columns, vector3Columns("cut_point")...)
+	columns = append(columns, vector3Columns("cut_normal")...)
+
+	return append(columns,
+		column{"cut_distance_to_center", floatKind},
+		column{"cut_angle", floatKind},
+		column{"before_cut_rating", floatKind},
+		column{"after_cut_rating", floatKind},
+	)
+}
+
+func vector3Columns(prefix string) []column {
+	return []column{
+		{prefix + "_x", floatKind},
+		{prefix + "_y", floatKind},
+		{prefix + "_z", floatKind},
+	}
+}
+
+func positionAndRotationColumns(prefix string) []column {
+	return append(append(vector3Columns(prefix+"_position"), vector3Columns(prefix+"_rotation")...), column{prefix + "_rotation_w", floatKind})
+}
+
+func (table Table) columns(opts *options) []column {
+	var columns []column
+	if opts.tags {
+		columns = append(columns, tagColumns...)
+	}
+
+	switch table {
+	case Frames:
+		return append(columns, frameColumns...)
+	case Notes:
+		return append(columns, noteColumns...)
+	default:
+		return columns
+	}
+}
+
+func (table Table) rowsCount(replay *bsor.Replay) int {
+	switch table {
+	case Frames:
+		return len(replay.Frames)
+	case Notes:
+		return len(replay.Notes)
+	default:
+		return 0
+	}
+}
+
+// row appends values of the row-th element of the table to values
+func (table Table) row(replay *bsor.Replay, row int, opts *options, values []value) []value {
+	if opts.tags {
+		values = append(values, value{str: replay.Info.Hash}, value{str: replay.Info.PlayerId}, value{str: replay.Info.Difficulty})
+	}
+
+	switch table {
+	case Frames:
+		return appendFrame(values, &replay.Frames[row])
+	case Notes:
+		return appendNote(values, &replay.Notes[row])
+	default:
+		return values
+	}
+}
+
+func floats(values []value, floats ...float32) []value {
+	for _, f := range floats {
+		values = append(values, value{float: f})
+	}
+
+	return values
+}
+
+func appendPositionAndRotation(values []value, pr *bsor.PositionAndRotation) []value {
+	return floats(values,
+		pr.Position.X, pr.Position.Y, pr.Position.Z,
+		pr.Rotation.X, pr.Rotation.Y, pr.Rotation.Z, pr.Rotation.W,
+	)
+}
+
+func appendFrame(values []value, frame *bsor.Frame) []value {
+	values = append(values, value{float: frame.Time}, value{int: frame.Fps})
+	values = appendPositionAndRotation(values, &frame.Head)
+	values = appendPositionAndRotation(values, &frame.LeftHand)
+
+	return appendPositionAndRotation(values, &frame.RightHand)
+}
+
+func appendNote(values []value, note *bsor.Note) []value {
+	cutInfo := &note.CutInfo
+
+	values = append(values,
+		value{int: int32(note.ScoringType)},
+		value{int: int32(note.LineIdx)},
+		value{int: int32(note.LineLayer)},
+		value{int: int32(note.ColorType)},
+		value{int: int32(note.CutDirection)},
+		value{float: note.EventTime},
+		value{float: note.SpawnTime},
+		value{int: int32(note.EventType)},
+		value{bool: cutInfo.SpeedOk},
+		value{bool: cutInfo.DirectionOk},
+		value{bool: cutInfo.SaberTypeOk},
+		value{bool: cutInfo.WasCutTooSoon},
+	)
+	values = floats(values, cutInfo.SaberSpeed, cutInfo.SaberDir.X, cutInfo.SaberDir.Y, cutInfo.SaberDir.Z)
+	values = append(values, value{int: cutInfo.SaberType})
+
+	return floats(values,
+		cutInfo.TimeDeviation, cutInfo.CutDirDeviation,
+		cutInfo.CutPoint.X, cutInfo.CutPoint.Y, cutInfo.CutPoint.Z,
+		cutInfo.CutNormal.X, cutInfo.CutNormal.Y, cutInfo.CutNormal.Z,
+		cutInfo.CutDistanceToCenter, cutInfo.CutAngle, cutInfo.BeforeCutRating, cutInfo.AfterCutRating,
+	)
+}
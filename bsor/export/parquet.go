@@ -0,0 +1,320 @@
+package export
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/motzel/go-bsor/bsor"
+)
+
+var ErrWriterClosed = errors.New("parquet writer is closed")
+
+var parquetMagic = []byte("PAR1")
+
+const createdBy = "github.com/motzel/go-bsor"
+
+// Parquet physical types, encodings and codecs
+const (
+	parquetBoolean   = 0
+	parquetInt32     = 1
+	parquetFloat     = 4
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetUtf8     = 0
+
+	parquetPlain = 0
+	parquetRle   = 3
+
+	parquetZstd     = 6
+	parquetDataPage = 0
+)
+
+func parquetType(kind kind) int32 {
+	switch kind {
+	case floatKind:
+		return parquetFloat
+	case intKind:
+		return parquetInt32
+	case boolKind:
+		return parquetBoolean
+	default:
+		return parquetByteArray
+	}
+}
+
+// columnBuffer holds PLAIN encoded values of the column in the current row group
+type columnBuffer struct {
+	data     []byte
+	bits     byte
+	bitCount int
+}
+
+func (c *columnBuffer) append(kind kind, value value) {
+	switch kind {
+	case floatKind:
+		c.data = appendUint32(c.data, math.Float32bits(value.float))
+	case intKind:
+		c.data = appendUint32(c.data, uint32(value.int))
+	case boolKind:
+		// booleans are bit packed, least significant bit first
+		if value.bool {
+			c.bits |= 1 << c.bitCount
+		}
+
+		if c.bitCount++; c.bitCount == 8 {
+			c.flushBits()
+		}
+	default:
+		c.data = appendUint32(c.data, uint32(len(value.str)))
+		c.data = append(c.data, value.str...)
+	}
+}
+
+func (c *columnBuffer) flushBits() {
+	if c.bitCount > 0 {
+		c.data = append(c.data, c.bits)
+		c.bits, c.bitCount = 0, 0
+	}
+}
+
+func appendUint32(data []byte, value uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], value)
+
+	return append(data, buf[:]...)
+}
+
+type columnChunk struct {
+	offset           int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+type rowGroup struct {
+	rows   int64
+	chunks []columnChunk
+}
+
+// ParquetWriter writes rows of many replays into a single Parquet file, every replay is stored
+// as a separate row group. All columns are required and compressed with zstd.
+type ParquetWriter struct {
+	writer    io.Writer
+	offset    int64
+	table     Table
+	options   *options
+	columns   []column
+	buffers   []columnBuffer
+	values    []value
+	rowGroups []rowGroup
+	encoder   *zstd.Encoder
+	closed    bool
+}
+
+func NewParquetWriter(writer io.Writer, table Table, options ...Option) *ParquetWriter {
+	opts := newOptions(options)
+	columns := table.columns(opts)
+
+	return &ParquetWriter{
+		writer:  writer,
+		table:   table,
+		options: opts,
+		columns: columns,
+		buffers: make([]columnBuffer, len(columns)),
+		values:  make([]value, 0, len(columns)),
+	}
+}
+
+func (w *ParquetWriter) write(data []byte) error {
+	written, err := w.writer.Write(data)
+	w.offset += int64(written)
+
+	return err
+}
+
+func (w *ParquetWriter) start() error {
+	if w.offset > 0 {
+		return nil
+	}
+
+	if w.encoder == nil {
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return err
+		}
+
+		w.encoder = encoder
+	}
+
+	return w.write(parquetMagic)
+}
+
+func (w *ParquetWriter) Write(replay *bsor.Replay) error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	rows := w.table.rowsCount(replay)
+	if rows == 0 {
+		return nil
+	}
+
+	for row := 0; row < rows; row++ {
+		w.values = w.table.row(replay, row, w.options, w.values[:0])
+
+		for i, column := range w.columns {
+			w.buffers[i].append(column.kind, w.values[i])
+		}
+	}
+
+	group := rowGroup{rows: int64(rows), chunks: make([]columnChunk, len(w.columns))}
+	for i := range w.buffers {
+		buffer := &w.buffers[i]
+		buffer.flushBits()
+
+		chunk, err := w.writePage(buffer.data, rows)
+		if err != nil {
+			return err
+		}
+
+		group.chunks[i] = chunk
+		buffer.data = buffer.data[:0]
+	}
+
+	w.rowGroups = append(w.rowGroups, group)
+
+	return nil
+}
+
+// writePage writes the column chunk of the row group as a single data page
+func (w *ParquetWriter) writePage(data []byte, rows int) (columnChunk, error) {
+	compressed := w.encoder.EncodeAll(data, nil)
+
+	header := newThriftWriter()
+	header.i32(1, parquetDataPage)
+	header.i32(2, int32(len(data)))
+	header.i32(3, int32(len(compressed)))
+	header.structField(5)
+	header.i32(1, int32(rows))
+	header.i32(2, parquetPlain)
+	header.i32(3, parquetRle)
+	header.i32(4, parquetRle)
+	header.endStruct()
+	header.endStruct()
+
+	chunk := columnChunk{
+		offset:           w.offset,
+		uncompressedSize: int64(len(header.buf) + len(data)),
+		compressedSize:   int64(len(header.buf) + len(compressed)),
+	}
+
+	if err := w.write(header.buf); err != nil {
+		return chunk, err
+	}
+
+	return chunk, w.write(compressed)
+}
+
+// Close writes the file metadata, the underlying writer is not closed.
+func (w *ParquetWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	w.closed = true
+
+	metadata := w.metadata()
+
+	if err := w.write(metadata); err != nil {
+		return err
+	}
+
+	if err := w.write(appendUint32(nil, uint32(len(metadata)))); err != nil {
+		return err
+	}
+
+	return w.write(parquetMagic)
+}
+
+func (w *ParquetWriter) metadata() []byte {
+	var rows int64
+	for _, group := range w.rowGroups {
+		rows += group.rows
+	}
+
+	meta := newThriftWriter()
+	meta.i32(1, 1)
+
+	// schema is flat, root element is followed by all the columns
+	meta.listHeader(2, thriftStruct, len(w.columns)+1)
+	meta.beginStruct()
+	meta.string(4, "schema")
+	meta.i32(5, int32(len(w.columns)))
+	meta.endStruct()
+	for _, column := range w.columns {
+		meta.beginStruct()
+		meta.i32(1, parquetType(column.kind))
+		meta.i32(3, parquetRequired)
+		meta.string(4, column.name)
+		if column.kind == stringKind {
+			meta.i32(6, parquetUtf8)
+		}
+		meta.endStruct()
+	}
+
+	meta.i64(3, rows)
+
+	meta.listHeader(4, thriftStruct, len(w.rowGroups))
+	for _, group := range w.rowGroups {
+		var totalSize int64
+
+		meta.beginStruct()
+		meta.listHeader(1, thriftStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			totalSize += chunk.uncompressedSize
+
+			meta.beginStruct()
+			meta.i64(2, chunk.offset)
+			meta.structField(3)
+			meta.i32(1, parquetType(w.columns[i].kind))
+			meta.i32List(2, parquetPlain, parquetRle)
+			meta.stringList(3, w.columns[i].name)
+			meta.i32(4, parquetZstd)
+			meta.i64(5, group.rows)
+			meta.i64(6, chunk.uncompressedSize)
+			meta.i64(7, chunk.compressedSize)
+			meta.i64(9, chunk.offset)
+			meta.endStruct()
+			meta.endStruct()
+		}
+		meta.i64(2, totalSize)
+		meta.i64(3, group.rows)
+		meta.endStruct()
+	}
+
+	meta.string(6, createdBy)
+	meta.endStruct()
+
+	return meta.buf
+}
+
+// WriteParquet writes rows of a single replay.
+func WriteParquet(writer io.Writer, table Table, replay *bsor.Replay, options ...Option) error {
+	parquetWriter := NewParquetWriter(writer, table, options...)
+	if err := parquetWriter.Write(replay); err != nil {
+		return err
+	}
+
+	return parquetWriter.Close()
+}
@@ -0,0 +1,276 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/motzel/go-bsor/bsor"
+)
+
+func testReplay(hash string, notes int) *bsor.Replay {
+	replay := &bsor.Replay{Info: bsor.Info{Hash: hash, PlayerId: "76561198059961776", Difficulty: "ExpertPlus"}}
+	for i := 0; i < notes; i++ {
+		replay.Notes = append(replay.Notes, bsor.Note{
+			ScoringType: bsor.Normal,
+			LineIdx:     bsor.LineValue(i % 4),
+			EventTime:   bsor.TimeValue(i),
+			SpawnTime:   bsor.TimeValue(i),
+			EventType:   bsor.Good,
+			CutInfo:     bsor.NoteCutInfo{SpeedOk: true, DirectionOk: i%2 == 0, SaberSpeed: 5},
+		})
+	}
+
+	return replay
+}
+
+func TestParquetStructure(t *testing.T) {
+	replays := []*bsor.Replay{testReplay("A", 3), testReplay("B", 0), testReplay("C", 10)}
+
+	var file bytes.Buffer
+	writer := NewParquetWriter(&file, Notes, WithTags())
+	for _, replay := range replays {
+		if err := writer.Write(replay); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := file.Bytes()
+	if !bytes.HasPrefix(data, parquetMagic) || !bytes.HasSuffix(data, parquetMagic) {
+		t.Fatalf("file does not start and end with %s", parquetMagic)
+	}
+
+	// the footer is the metadata followed by its length and the magic
+	footerLength := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footerStart := len(data) - 8 - footerLength
+	if footerStart < len(parquetMagic) {
+		t.Fatalf("footer length %v does not fit in the file of %v bytes", footerLength, len(data))
+	}
+
+	reader := &thriftReader{data: data[footerStart : len(data)-8]}
+	metadata := reader.readStruct()
+	if reader.err != nil || reader.offset != footerLength {
+		t.Fatalf("metadata of %v bytes read as %v bytes: %v", footerLength, reader.offset, reader.err)
+	}
+
+	columns := append(append([]column{}, tagColumns...), noteColumns...)
+
+	names := []string{"schema"}
+	for _, column := range columns {
+		names = append(names, column.name)
+	}
+
+	var schemaNames []string
+	for _, element := range metadata[2].([]any) {
+		schemaNames = append(schemaNames, string(element.(thriftFields)[4].([]byte)))
+	}
+
+	if !reflect.DeepEqual(schemaNames, names) {
+		t.Errorf("got schema %v, want %v", schemaNames, names)
+	}
+
+	if rows := metadata[3].(int64); rows != 13 {
+		t.Errorf("got %v rows, want 13", rows)
+	}
+
+	// replays without rows don't add row groups
+	wantRows := []int64{3, 10}
+
+	rowGroups := metadata[4].([]any)
+	if len(rowGroups) != len(wantRows) {
+		t.Fatalf("got %v row groups, want %v", len(rowGroups), len(wantRows))
+	}
+
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer decoder.Close()
+
+	for i, rowGroup := range rowGroups {
+		group := rowGroup.(thriftFields)
+		if group[3].(int64) != wantRows[i] {
+			t.Errorf("row group %v has %v rows, want %v", i, group[3], wantRows[i])
+		}
+
+		chunks := group[1].([]any)
+		if len(chunks) != len(columns) {
+			t.Fatalf("row group %v has %v columns, want %v", i, len(chunks), len(columns))
+		}
+
+		for j, chunk := range chunks {
+			meta := chunk.(thriftFields)[3].(thriftFields)
+			offset := meta[9].(int64)
+			if meta[5].(int64) != wantRows[i] || offset < int64(len(parquetMagic)) || offset >= int64(footerStart) {
+				t.Fatalf("column %v of row group %v has %v values at offset %v", columns[j].name, i, meta[5], offset)
+			}
+
+			values, err := readPage(data[offset:footerStart], decoder)
+			if err != nil {
+				t.Fatalf("column %v of row group %v: %v", columns[j].name, i, err)
+			}
+
+			if size := plainSize(columns[j].kind, values, int(wantRows[i])); size != len(values) {
+				t.Errorf("column %v of row group %v has %v bytes of values, want %v", columns[j].name, i, len(values), size)
+			}
+		}
+
+		// the first column holds hashes of replays
+		values, _ := readPage(data[chunks[0].(thriftFields)[3].(thriftFields)[9].(int64):], decoder)
+		if hash := string(values[4 : 4+binary.LittleEndian.Uint32(values)]); hash != []string{"A", "C"}[i] {
+			t.Errorf("row group %v has hash %v", i, hash)
+		}
+	}
+}
+
+// readPage decodes the page header and returns decompressed values of the page
+func readPage(data []byte, decoder *zstd.Decoder) ([]byte, error) {
+	reader := &thriftReader{data: data}
+	header := reader.readStruct()
+	if reader.err != nil {
+		return nil, reader.err
+	}
+
+	compressedSize := int(header[3].(int64))
+	if reader.offset+compressedSize > len(data) {
+		return nil, fmt.Errorf("page of %v bytes is truncated", compressedSize)
+	}
+
+	values, err := decoder.DecodeAll(data[reader.offset:reader.offset+compressedSize], nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(values) != int(header[2].(int64)) {
+		return nil, fmt.Errorf("page has %v bytes, header says %v", len(values), header[2])
+	}
+
+	return values, nil
+}
+
+// plainSize returns the size of rows PLAIN encoded values of the kind
+func plainSize(kind kind, values []byte, rows int) int {
+	switch kind {
+	case boolKind:
+		return (rows + 7) / 8
+	case stringKind:
+		size := 0
+		for i := 0; i < rows && size+4 <= len(values); i++ {
+			size += 4 + int(binary.LittleEndian.Uint32(values[size:]))
+		}
+
+		return size
+	default:
+		return rows * 4
+	}
+}
+
+// thriftFields holds fields of a decoded struct by their ids
+type thriftFields map[int16]any
+
+// thriftReader decodes Thrift compact protocol types written by thriftWriter
+type thriftReader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (t *thriftReader) byte() byte {
+	if t.offset >= len(t.data) {
+		if t.err == nil {
+			t.err = fmt.Errorf("unexpected end at %v", t.offset)
+		}
+
+		return 0
+	}
+
+	t.offset++
+
+	return t.data[t.offset-1]
+}
+
+func (t *thriftReader) uvarint() uint64 {
+	var value uint64
+	for shift := 0; shift < 64 && t.err == nil; shift += 7 {
+		b := t.byte()
+		value |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			break
+		}
+	}
+
+	return value
+}
+
+func (t *thriftReader) varint() int64 {
+	value := t.uvarint()
+
+	return int64(value>>1) ^ -int64(value&1)
+}
+
+func (t *thriftReader) value(valueType byte) any {
+	switch valueType {
+	case thriftI32, thriftI64:
+		return t.varint()
+	case thriftBinary:
+		length := int(t.uvarint())
+		if t.err != nil || t.offset+length > len(t.data) {
+			t.err = fmt.Errorf("binary of %v bytes at %v is truncated", length, t.offset)
+
+			return nil
+		}
+
+		t.offset += length
+
+		return t.data[t.offset-length : t.offset]
+	case thriftList:
+		header := t.byte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(t.uvarint())
+		}
+
+		list := []any{}
+		for i := 0; i < size && t.err == nil; i++ {
+			list = append(list, t.value(header&0x0f))
+		}
+
+		return list
+	case thriftStruct:
+		return t.readStruct()
+	default:
+		t.err = fmt.Errorf("unsupported type %v at %v", valueType, t.offset)
+
+		return nil
+	}
+}
+
+func (t *thriftReader) readStruct() thriftFields {
+	fields := thriftFields{}
+
+	var id int16
+	for t.err == nil {
+		header := t.byte()
+		if header == 0 {
+			break
+		}
+
+		if delta := int16(header >> 4); delta > 0 {
+			id += delta
+		} else {
+			id = int16(t.varint())
+		}
+
+		fields[id] = t.value(header & 0x0f)
+	}
+
+	return fields
+}
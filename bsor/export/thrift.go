@@ -0,0 +1,103 @@
+package export
+
+// thrift compact protocol types used by Parquet metadata
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes Parquet metadata with Thrift compact protocol, only the parts needed here
+type thriftWriter struct {
+	buf       []byte
+	lastField []int16
+}
+
+// newThriftWriter starts the top level struct, it has to be ended with endStruct too
+func newThriftWriter() *thriftWriter {
+	return &thriftWriter{lastField: []int16{0}}
+}
+
+func (t *thriftWriter) uvarint(value uint64) {
+	for value >= 0x80 {
+		t.buf = append(t.buf, byte(value)|0x80)
+		value >>= 7
+	}
+
+	t.buf = append(t.buf, byte(value))
+}
+
+// varint writes zigzag encoded value
+func (t *thriftWriter) varint(value int64) {
+	t.uvarint(uint64(value<<1) ^ uint64(value>>63))
+}
+
+func (t *thriftWriter) fieldHeader(id int16, fieldType byte) {
+	last := &t.lastField[len(t.lastField)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|fieldType)
+	} else {
+		t.buf = append(t.buf, fieldType)
+		t.varint(int64(id))
+	}
+
+	*last = id
+}
+
+func (t *thriftWriter) i32(id int16, value int32) {
+	t.fieldHeader(id, thriftI32)
+	t.varint(int64(value))
+}
+
+func (t *thriftWriter) i64(id int16, value int64) {
+	t.fieldHeader(id, thriftI64)
+	t.varint(value)
+}
+
+func (t *thriftWriter) string(id int16, value string) {
+	t.fieldHeader(id, thriftBinary)
+	t.uvarint(uint64(len(value)))
+	t.buf = append(t.buf, value...)
+}
+
+func (t *thriftWriter) listHeader(id int16, elementType byte, size int) {
+	t.fieldHeader(id, thriftList)
+	if size < 15 {
+		t.buf = append(t.buf, byte(size)<<4|elementType)
+	} else {
+		t.buf = append(t.buf, 0xf0|elementType)
+		t.uvarint(uint64(size))
+	}
+}
+
+func (t *thriftWriter) i32List(id int16, values ...int32) {
+	t.listHeader(id, thriftI32, len(values))
+	for _, value := range values {
+		t.varint(int64(value))
+	}
+}
+
+func (t *thriftWriter) stringList(id int16, values ...string) {
+	t.listHeader(id, thriftBinary, len(values))
+	for _, value := range values {
+		t.uvarint(uint64(len(value)))
+		t.buf = append(t.buf, value...)
+	}
+}
+
+// structField starts a struct stored in a field, elements of struct lists are started with beginStruct
+func (t *thriftWriter) structField(id int16) {
+	t.fieldHeader(id, thriftStruct)
+	t.beginStruct()
+}
+
+func (t *thriftWriter) beginStruct() {
+	t.lastField = append(t.lastField, 0)
+}
+
+func (t *thriftWriter) endStruct() {
+	t.buf = append(t.buf, 0)
+	t.lastField = t.lastField[:len(t.lastField)-1]
+}
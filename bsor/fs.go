@@ -0,0 +1,132 @@
+package bsor
+
+import (
+	"context"
+	"io/fs"
+	"runtime"
+)
+
+type fsResult struct {
+	ArchivedReplay
+	directory bool
+}
+
+// StreamFS decodes all files of fsys matching the fs.Glob pattern, raw or gzip or zstd compressed,
+// using a bounded pool of workers (see WithWorkers). Results are delivered in the order of names
+// returned by fs.Glob, files which failed to decode have Err set. Directories matching the pattern
+// are skipped and zip archives yield ErrZipArchive. The channel is closed after the last file
+// or when ctx is cancelled, it has to be drained unless ctx is cancelled.
+func StreamFS(ctx context.Context, fsys fs.FS, pattern string, options ...ReadOption) (<-chan ArchivedReplay, error) {
+	names, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	workers := newReadOptions(options).workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	// every file gets its own result channel, so results can be delivered in order; the buffer
+	// bounds the number of decoded replays waiting for a slow consumer
+	pending := make(chan chan fsResult, workers)
+	running := make(chan struct{}, workers)
+	replays := make(chan ArchivedReplay)
+
+	go func() {
+		defer close(pending)
+
+		for _, name := range names {
+			result := make(chan fsResult, 1)
+
+			select {
+			case pending <- result:
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case running <- struct{}{}:
+			case <-ctx.Done():
+				result <- fsResult{ArchivedReplay: ArchivedReplay{Name: name, Err: ctx.Err()}}
+				return
+			}
+
+			go func(name string) {
+				defer func() { <-running }()
+
+				result <- readFSFile(ctx, fsys, name, options)
+			}(name)
+		}
+	}()
+
+	go func() {
+		defer close(replays)
+
+		for result := range pending {
+			replay := <-result
+			if replay.directory {
+				continue
+			}
+
+			select {
+			case replays <- replay.ArchivedReplay:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return replays, nil
+}
+
+func readFSFile(ctx context.Context, fsys fs.FS, name string, options []ReadOption) fsResult {
+	result := fsResult{ArchivedReplay: ArchivedReplay{Name: name}}
+
+	file, err := fsys.Open(name)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	if info.IsDir() {
+		result.directory = true
+		return result
+	}
+
+	decompressed, err := Decompress(file)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	defer decompressed.Close()
+
+	result.Replay, result.Err = ReadContext(ctx, decompressed, options...)
+
+	return result
+}
+
+// ReadFS decodes all files of fsys matching the fs.Glob pattern like StreamFS does and returns
+// them in the order of their names. All the replays are kept in memory, use StreamFS for large directories.
+func ReadFS(fsys fs.FS, pattern string, options ...ReadOption) ([]ArchivedReplay, error) {
+	results, err := StreamFS(context.Background(), fsys, pattern, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	var replays []ArchivedReplay
+	for replay := range results {
+		replays = append(replays, replay)
+	}
+
+	return replays, nil
+}
@@ -0,0 +1,247 @@
+package bsor
+
+import "io"
+
+var ErrPartNotIndexed = Error{"part not found in index"}
+var ErrElementOutOfRange = Error{"element index out of range"}
+
+type PartIndex struct {
+	Type   PartType  `json:"type"`
+	Offset int64     `json:"offset"`
+	Count  ReplayInt `json:"count"`
+}
+
+type ReplayIndex struct {
+	Header Header      `json:"header"`
+	Size   int64       `json:"size"`
+	Parts  []PartIndex `json:"parts"`
+	// limits given to Index apply to reading the indexed parts too, DefaultLimits are used if not set
+	limits *Limits
+}
+
+// Index scans the replay once and records where every part starts. Offset of the part points
+// at its first element (right after the part type and the element count), Count is the number
+// of elements (1 for Info and ControllerOffsets parts). Only replays of BuiltinVersion can be indexed.
+// Limits given with WithLimits are also used by the methods reading the indexed parts.
+func Index(readSeeker io.ReadSeeker, options ...ReadOption) (*ReplayIndex, error) {
+	var index ReplayIndex
+	var err error
+
+	limits := newReadOptions(options).limits
+	index.limits = &limits
+
+	reader := newDecodeReader(readSeeker, limits)
+
+	if index.Size, err = readSeeker.Seek(0, io.SeekEnd); err != nil {
+		return nil, reader.decodeError(UnknownPart, -1, err)
+	}
+
+	if _, err = readSeeker.Seek(0, io.SeekStart); err != nil {
+		return nil, reader.decodeError(UnknownPart, -1, err)
+	}
+
+	if err = readBuiltinHeader(reader, &index.Header); err != nil {
+		return nil, reader.decodeError(UnknownPart, -1, err)
+	}
+
+	for {
+		var partType PartType
+		if partType, err = readPartType(reader); err != nil {
+			if err == io.EOF {
+				return &index, nil
+			}
+
+			return nil, reader.decodeError(UnknownPart, -1, err)
+		}
+
+		part := PartIndex{Type: partType, Count: 1}
+
+		switch partType {
+		case InfoPart, ControllerOffsetsPart:
+			part.Offset = reader.offset
+			err = skipPart(reader, partType)
+
+		case FramesPart, NotesPart, WallsPart, HeightsPart, PausesPart, CustomDataPart:
+			var count int
+			if count, err = readPartCount(reader, partType); err != nil {
+				break
+			}
+
+			part.Count = ReplayInt(count)
+			part.Offset = reader.offset
+			err = skipPartElements(reader, partType, count)
+
+		default:
+			err = reader.fieldAt("partType", reader.offset-1).fieldError(ErrUnknownPart)
+		}
+
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		if err != nil {
+			return nil, reader.decodeError(partType, -1, err)
+		}
+
+		// seeking past the end is not an error, so truncated parts must be detected here
+		if reader.offset > index.Size {
+			return nil, reader.fieldAt("", index.Size).decodeError(partType, -1, io.ErrUnexpectedEOF)
+		}
+
+		index.Parts = append(index.Parts, part)
+	}
+}
+
+func (index *ReplayIndex) readLimits() Limits {
+	if index.limits == nil {
+		return DefaultLimits
+	}
+
+	return *index.limits
+}
+
+func (index *ReplayIndex) Part(partType PartType) (PartIndex, bool) {
+	for _, part := range index.Parts {
+		if part.Type == partType {
+			return part, true
+		}
+	}
+
+	return PartIndex{}, false
+}
+
+func (index *ReplayIndex) seek(readSeeker io.ReadSeeker, partType PartType) (*decodeReader, PartIndex, error) {
+	part, found := index.Part(partType)
+	if !found {
+		return nil, part, &DecodeError{Part: partType, Index: -1, Err: ErrPartNotIndexed}
+	}
+
+	if _, err := readSeeker.Seek(part.Offset, io.SeekStart); err != nil {
+		return nil, part, &DecodeError{Part: partType, Index: -1, Offset: part.Offset, Err: err}
+	}
+
+	// offsets reported in errors are absolute, as the reader starts in the middle of the replay
+	reader := newDecodeReader(readSeeker, index.readLimits())
+	reader.offset = part.Offset
+
+	// indexes unmarshalled from JSON have counts which were never validated
+	if err := checkIndexedCount(reader, part); err != nil {
+		return nil, part, reader.fieldAt("count", part.Offset-4).decodeError(partType, -1, err)
+	}
+
+	return reader, part, nil
+}
+
+func checkIndexedCount(reader *decodeReader, part PartIndex) error {
+	if part.Count < 0 {
+		return ErrInvalidLength
+	}
+
+	if what, max, _ := reader.limits.forPart(part.Type); max > 0 && int(part.Count) > max {
+		return limitError(what, int64(part.Count), int64(max))
+	}
+
+	return nil
+}
+
+func (index *ReplayIndex) ReadInfo(readSeeker io.ReadSeeker) (*Info, error) {
+	reader, _, err := index.seek(readSeeker, InfoPart)
+	if err != nil {
+		return nil, err
+	}
+
+	var info Info
+	if err = readInfo(reader, &info); err != nil {
+		return nil, reader.decodeError(InfoPart, -1, err)
+	}
+
+	return &info, nil
+}
+
+func (index *ReplayIndex) FramesCount() int {
+	part, _ := index.Part(FramesPart)
+
+	return int(part.Count)
+}
+
+// ReadFrames decodes frames from the [from, to) range without reading the preceding ones.
+func (index *ReplayIndex) ReadFrames(readSeeker io.ReadSeeker, from int, to int) ([]Frame, error) {
+	part, found := index.Part(FramesPart)
+	if !found {
+		return nil, &DecodeError{Part: FramesPart, Index: -1, Err: ErrPartNotIndexed}
+	}
+
+	if from < 0 || to > int(part.Count) || from > to {
+		return nil, &DecodeError{Part: FramesPart, Index: from, Err: ErrElementOutOfRange}
+	}
+
+	offset := part.Offset + int64(from)*int64(frameSize)
+	if _, err := readSeeker.Seek(offset, io.SeekStart); err != nil {
+		return nil, &DecodeError{Part: FramesPart, Index: from, Offset: offset, Err: err}
+	}
+
+	reader := newDecodeReader(readSeeker, index.readLimits())
+	reader.offset = offset
+
+	if err := checkIndexedCount(reader, part); err != nil {
+		return nil, reader.fieldAt("count", part.Offset-4).decodeError(FramesPart, -1, err)
+	}
+
+	frames := make([]Frame, to-from)
+	for i := range frames {
+		if err := readFrame(reader, &frames[i]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+
+			return nil, reader.decodeError(FramesPart, from+i, err)
+		}
+	}
+
+	return frames, nil
+}
+
+func (index *ReplayIndex) ReadFrame(readSeeker io.ReadSeeker, n int) (*Frame, error) {
+	frames, err := index.ReadFrames(readSeeker, n, n+1)
+	if err != nil {
+		return nil, err
+	}
+
+	return &frames[0], nil
+}
+
+func (index *ReplayIndex) ReadNotes(readSeeker io.ReadSeeker) ([]Note, error) {
+	return readIndexedPart(index, readSeeker, NotesPart, readNote)
+}
+
+func (index *ReplayIndex) ReadWalls(readSeeker io.ReadSeeker) ([]WallHit, error) {
+	return readIndexedPart(index, readSeeker, WallsPart, readWall)
+}
+
+func (index *ReplayIndex) ReadHeights(readSeeker io.ReadSeeker) ([]AutomaticHeight, error) {
+	return readIndexedPart(index, readSeeker, HeightsPart, readHeight)
+}
+
+func (index *ReplayIndex) ReadPauses(readSeeker io.ReadSeeker) ([]Pause, error) {
+	return readIndexedPart(index, readSeeker, PausesPart, readPause)
+}
+
+func readIndexedPart[T any](index *ReplayIndex, readSeeker io.ReadSeeker, partType PartType, read func(*decodeReader, *T) error) ([]T, error) {
+	reader, part, err := index.seek(readSeeker, partType)
+	if err != nil {
+		return nil, err
+	}
+
+	elements := make([]T, part.Count)
+	for i := range elements {
+		if err = read(reader, &elements[i]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+
+			return nil, reader.decodeError(partType, i, err)
+		}
+	}
+
+	return elements, nil
+}
@@ -0,0 +1,58 @@
+package bsor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestIndexLimits(t *testing.T) {
+	data := writeReplay(t, testReplay(100))
+
+	if _, err := Index(bytes.NewReader(data), WithLimits(Limits{MaxFrames: 99})); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("got %v, want %v", err, ErrLimitExceeded)
+	}
+
+	index := func(options ...ReadOption) *ReplayIndex {
+		index, err := Index(bytes.NewReader(data), options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return index
+	}
+
+	// indexes loaded from JSON have no limits stored, the defaults are used then
+	var unmarshalled ReplayIndex
+	if encoded, err := json.Marshal(index()); err != nil || json.Unmarshal(encoded, &unmarshalled) != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		index  *ReplayIndex
+		frames ReplayInt
+		err    error
+	}{
+		{"default limits", index(), ReplayInt(DefaultLimits.MaxFrames) + 1, ErrLimitExceeded},
+		{"no limits", index(WithLimits(NoLimits)), ReplayInt(DefaultLimits.MaxFrames) + 1, nil},
+		{"given limits", index(WithLimits(Limits{MaxFrames: 200})), 201, ErrLimitExceeded},
+		{"unmarshalled", &unmarshalled, ReplayInt(DefaultLimits.MaxFrames) + 1, ErrLimitExceeded},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// a count changed after indexing is not validated by Index
+			for i := range test.index.Parts {
+				if test.index.Parts[i].Type == FramesPart {
+					test.index.Parts[i].Count = test.frames
+				}
+			}
+
+			if _, err := test.index.ReadFrames(bytes.NewReader(data), 0, 10); !errors.Is(err, test.err) {
+				t.Errorf("got %v, want %v", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package bsor
+
+import "math"
+
+func lerp(a ReplayFloat, b ReplayFloat, t float64) ReplayFloat {
+	return ReplayFloat(float64(a) + (float64(b)-float64(a))*t)
+}
+
+func lerpPosition(a Position, b Position, t float64) Position {
+	return Position{X: lerp(a.X, b.X, t), Y: lerp(a.Y, b.Y, t), Z: lerp(a.Z, b.Z, t)}
+}
+
+func rotationDot(a Rotation, b Rotation) float64 {
+	return float64(a.X)*float64(b.X) + float64(a.Y)*float64(b.Y) + float64(a.Z)*float64(b.Z) + float64(a.W)*float64(b.W)
+}
+
+// slerpRotation interpolates along the shorter arc, q and -q are the same rotation
+func slerpRotation(a Rotation, b Rotation, t float64) Rotation {
+	dot := rotationDot(a, b)
+	if dot < 0 {
+		dot = -dot
+		b = Rotation{Vector3: Vector3{X: -b.X, Y: -b.Y, Z: -b.Z}, W: -b.W}
+	}
+
+	weightA, weightB := 1-t, t
+
+	// nearly equal rotations are lerped, sin of the angle would lose precision there
+	if dot < 0.9995 {
+		angle := math.Acos(dot)
+		sin := math.Sin(angle)
+		weightA = math.Sin((1-t)*angle) / sin
+		weightB = math.Sin(t*angle) / sin
+	}
+
+	rotation := Rotation{
+		Vector3: Vector3{
+			X: ReplayFloat(weightA*float64(a.X) + weightB*float64(b.X)),
+			Y: ReplayFloat(weightA*float64(a.Y) + weightB*float64(b.Y)),
+			Z: ReplayFloat(weightA*float64(a.Z) + weightB*float64(b.Z)),
+		},
+		W: ReplayFloat(weightA*float64(a.W) + weightB*float64(b.W)),
+	}
+
+	if length := math.Sqrt(rotationDot(rotation, rotation)); length > 0 {
+		rotation.X = ReplayFloat(float64(rotation.X) / length)
+		rotation.Y = ReplayFloat(float64(rotation.Y) / length)
+		rotation.Z = ReplayFloat(float64(rotation.Z) / length)
+		rotation.W = ReplayFloat(float64(rotation.W) / length)
+	}
+
+	return rotation
+}
+
+func interpolatePose(a *PositionAndRotation, b *PositionAndRotation, t float64) PositionAndRotation {
+	return PositionAndRotation{
+		Position: lerpPosition(a.Position, b.Position, t),
+		Rotation: slerpRotation(a.Rotation, b.Rotation, t),
+	}
+}
+
+func positionDistance(a Position, b Position) float64 {
+	x, y, z := float64(a.X)-float64(b.X), float64(a.Y)-float64(b.Y), float64(a.Z)-float64(b.Z)
+
+	return math.Sqrt(x*x + y*y + z*z)
+}
+
+// rotationAngle returns the angle in radians of the rotation between a and b
+func rotationAngle(a Rotation, b Rotation) float64 {
+	lengths := math.Sqrt(rotationDot(a, a) * rotationDot(b, b))
+	if lengths == 0 {
+		return 0
+	}
+
+	return 2 * math.Acos(math.Min(math.Abs(rotationDot(a, b))/lengths, 1))
+}
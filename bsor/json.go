@@ -0,0 +1,432 @@
+package bsor
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type EnumFormat byte
+
+const (
+	NumericEnums EnumFormat = iota
+	StringEnums
+)
+
+type JSONOption func(*jsonOptions)
+
+type jsonOptions struct {
+	enumFormat EnumFormat
+}
+
+// JSONEnumFormat selects how NoteEventType, ColorType, CutDirection and NoteScoringType are marshalled by MarshalJSON.
+// Unmarshalling always accepts both forms. Values without a name are marshalled as numbers in both formats.
+func JSONEnumFormat(format EnumFormat) JSONOption {
+	return func(opts *jsonOptions) {
+		opts.enumFormat = format
+	}
+}
+
+type jsonEnum interface {
+	~byte | ~int32
+	String() string
+}
+
+// namedEnum is implemented by the enums which can be marshalled by their names
+type namedEnum interface {
+	enumName() (string, bool)
+}
+
+var noteEventTypes = []NoteEventType{Good, Bad, Miss, Bomb}
+var colorTypes = []ColorType{Red, Blue, NoColor}
+var cutDirections = []CutDirection{TopCenter, BottomCenter, MiddleLeft, MiddleRight, TopLeft, TopRight, BottomLeft, BottomRight, Dot}
+var noteScoringTypes = []NoteScoringType{NormalOld, Ignore, NoScore, Normal, SliderHead, SliderTail, BurstSliderHead, BurstSliderElement}
+
+// MarshalJSON works like json.Marshal with the options applied to this call only, so outputs with both enum
+// formats can be marshalled concurrently. Enums are always marshalled as numbers by json.Marshal.
+func MarshalJSON(value any, options ...JSONOption) ([]byte, error) {
+	opts := &jsonOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil || opts.enumFormat != StringEnums {
+		return data, err
+	}
+
+	return nameEnums(data, reflect.ValueOf(value))
+}
+
+func enumName[T jsonEnum](value T, values []T) (string, bool) {
+	for _, known := range values {
+		if known == value {
+			return value.String(), true
+		}
+	}
+
+	return "", false
+}
+
+func marshalEnum[T jsonEnum](value T) ([]byte, error) {
+	return []byte(strconv.FormatInt(int64(value), 10)), nil
+}
+
+func unmarshalEnum[T jsonEnum](data []byte, value *T, values []T) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		// not a string, so it has to be a number
+		number, err := strconv.ParseInt(string(data), 10, 64)
+		if err != nil || int64(T(number)) != number {
+			return fmt.Errorf("invalid %T value %s", *value, data)
+		}
+
+		*value = T(number)
+
+		return nil
+	}
+
+	for _, known := range values {
+		if known.String() == name {
+			*value = known
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown %T value %q", *value, name)
+}
+
+func enumSchema[T jsonEnum](values []T) map[string]any {
+	names := make([]string, len(values))
+	for i, value := range values {
+		names[i] = value.String()
+	}
+
+	return map[string]any{
+		"oneOf": []any{
+			map[string]any{"type": "integer"},
+			map[string]any{"type": "string", "enum": names},
+		},
+	}
+}
+
+func (s NoteEventType) MarshalJSON() ([]byte, error) { return marshalEnum(s) }
+
+func (s NoteEventType) enumName() (string, bool) { return enumName(s, noteEventTypes) }
+
+func (s *NoteEventType) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum(data, s, noteEventTypes)
+}
+
+func (NoteEventType) JSONSchema() map[string]any { return enumSchema(noteEventTypes) }
+
+func (s ColorType) MarshalJSON() ([]byte, error) { return marshalEnum(s) }
+
+func (s ColorType) enumName() (string, bool) { return enumName(s, colorTypes) }
+
+func (s *ColorType) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum(data, s, colorTypes)
+}
+
+func (ColorType) JSONSchema() map[string]any { return enumSchema(colorTypes) }
+
+func (s CutDirection) MarshalJSON() ([]byte, error) { return marshalEnum(s) }
+
+func (s CutDirection) enumName() (string, bool) { return enumName(s, cutDirections) }
+
+func (s *CutDirection) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum(data, s, cutDirections)
+}
+
+func (CutDirection) JSONSchema() map[string]any { return enumSchema(cutDirections) }
+
+func (s NoteScoringType) MarshalJSON() ([]byte, error) { return marshalEnum(s) }
+
+func (s NoteScoringType) enumName() (string, bool) { return enumName(s, noteScoringTypes) }
+
+func (s *NoteScoringType) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum(data, s, noteScoringTypes)
+}
+
+func (NoteScoringType) JSONSchema() map[string]any { return enumSchema(noteScoringTypes) }
+
+var namedEnumType = reflect.TypeOf((*namedEnum)(nil)).Elem()
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// enumRewriter copies JSON marshalled with numeric enums, following the marshalled value to find the enums
+// which are replaced by their names, so no JSON is parsed without knowing the Go type behind it
+type enumRewriter struct {
+	decoder *json.Decoder
+	out     bytes.Buffer
+}
+
+func nameEnums(data []byte, value reflect.Value) ([]byte, error) {
+	rewriter := &enumRewriter{decoder: json.NewDecoder(bytes.NewReader(data))}
+	rewriter.out.Grow(len(data) + len(data)/4)
+
+	if err := rewriter.value(value); err != nil {
+		return nil, err
+	}
+
+	return rewriter.out.Bytes(), nil
+}
+
+func (r *enumRewriter) value(v reflect.Value) error {
+	for (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	if !v.IsValid() || !v.CanInterface() || !containsEnum(v.Type()) {
+		return r.copy()
+	}
+
+	if enum, ok := v.Interface().(namedEnum); ok {
+		if name, known := enum.enumName(); known {
+			if err := r.skip(); err != nil {
+				return err
+			}
+
+			return r.write(name)
+		}
+
+		return r.copy()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		fields := cachedJSONFields(v.Type())
+
+		return r.object(func(key string) reflect.Value {
+			index, found := fields[key]
+			if !found {
+				return reflect.Value{}
+			}
+
+			// the field of a nil embedded pointer is not marshalled, so it's never looked up
+			field, _ := v.FieldByIndexErr(index)
+
+			return field
+		})
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return r.copy()
+		}
+
+		return r.object(func(key string) reflect.Value {
+			return v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+		})
+
+	case reflect.Slice, reflect.Array:
+		return r.array(v)
+
+	default:
+		return r.copy()
+	}
+}
+
+func (r *enumRewriter) object(field func(key string) reflect.Value) error {
+	token, err := r.decoder.Token()
+	if err != nil || token == nil {
+		r.out.WriteString("null")
+
+		return err
+	}
+
+	r.out.WriteByte('{')
+
+	for i := 0; r.decoder.More(); i++ {
+		if token, err = r.decoder.Token(); err != nil {
+			return err
+		}
+
+		key, _ := token.(string)
+		if i > 0 {
+			r.out.WriteByte(',')
+		}
+
+		if err = r.write(key); err != nil {
+			return err
+		}
+
+		r.out.WriteByte(':')
+
+		if err = r.value(field(key)); err != nil {
+			return err
+		}
+	}
+
+	if _, err = r.decoder.Token(); err != nil {
+		return err
+	}
+
+	r.out.WriteByte('}')
+
+	return nil
+}
+
+func (r *enumRewriter) array(v reflect.Value) error {
+	token, err := r.decoder.Token()
+	if err != nil || token == nil {
+		r.out.WriteString("null")
+
+		return err
+	}
+
+	r.out.WriteByte('[')
+
+	for i := 0; r.decoder.More(); i++ {
+		if i > 0 {
+			r.out.WriteByte(',')
+		}
+
+		var element reflect.Value
+		if i < v.Len() {
+			element = v.Index(i)
+		}
+
+		if err = r.value(element); err != nil {
+			return err
+		}
+	}
+
+	if _, err = r.decoder.Token(); err != nil {
+		return err
+	}
+
+	r.out.WriteByte(']')
+
+	return nil
+}
+
+// copy writes the next JSON value as it is
+func (r *enumRewriter) copy() error {
+	var raw json.RawMessage
+	if err := r.decoder.Decode(&raw); err != nil {
+		return err
+	}
+
+	r.out.Write(raw)
+
+	return nil
+}
+
+func (r *enumRewriter) skip() error {
+	var raw json.RawMessage
+
+	return r.decoder.Decode(&raw)
+}
+
+func (r *enumRewriter) write(str string) error {
+	data, err := json.Marshal(str)
+	r.out.Write(data)
+
+	return err
+}
+
+var enumTypes sync.Map
+var jsonFields sync.Map
+
+// containsEnum reports whether values of the type can hold a named enum, marshalled by encoding/json itself
+func containsEnum(t reflect.Type) bool {
+	if contains, found := enumTypes.Load(t); found {
+		return contains.(bool)
+	}
+
+	contains := typeContainsEnum(t, map[reflect.Type]bool{})
+	enumTypes.Store(t, contains)
+
+	return contains
+}
+
+func typeContainsEnum(t reflect.Type, visited map[reflect.Type]bool) bool {
+	if t.Implements(namedEnumType) {
+		return true
+	}
+
+	if visited[t] || t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType) ||
+		t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType) {
+		return false
+	}
+
+	visited[t] = true
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return typeContainsEnum(t.Elem(), visited)
+	case reflect.Struct:
+		for _, index := range cachedJSONFields(t) {
+			if typeContainsEnum(t.FieldByIndex(index).Type, visited) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func cachedJSONFields(t reflect.Type) map[string][]int {
+	if fields, found := jsonFields.Load(t); found {
+		return fields.(map[string][]int)
+	}
+
+	fields := map[string][]int{}
+	collectJSONFields(t, nil, fields)
+	jsonFields.Store(t, fields)
+
+	return fields
+}
+
+// collectJSONFields maps JSON keys to fields the way encoding/json does, fields of embedded structs
+// are promoted unless a shallower field has the same key
+func collectJSONFields(t reflect.Type, index []int, fields map[string][]int) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+		fieldIndex := append(append([]int{}, index...), i)
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+
+			if embedded.Kind() == reflect.Struct {
+				collectJSONFields(embedded, fieldIndex, fields)
+
+				continue
+			}
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		if existing, found := fields[name]; !found || len(fieldIndex) < len(existing) {
+			fields[name] = fieldIndex
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package bsor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/motzel/go-bsor/bsor/schema"
+)
+
+var schemaFiles = []struct {
+	file  string
+	title string
+	value any
+}{
+	{"replay.schema.json", "Replay", Replay{}},
+	{"replay-events.schema.json", "ReplayEvents", ReplayEvents{}},
+	{"replay-stats.schema.json", "ReplayStats", ReplayStats{}},
+}
+
+func TestSchemaUpToDate(t *testing.T) {
+	for _, document := range schemaFiles {
+		t.Run(document.file, func(t *testing.T) {
+			committed, err := os.ReadFile(filepath.Join("..", "schema", document.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			generated, err := schema.Generate(document.value, document.title)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(committed, append(generated, '\n')) {
+				t.Errorf("%v is out of date, run go generate in cmd/bsor-schema", document.file)
+			}
+		})
+	}
+}
+
+// TestJSONRoundTrip checks that marshalled values are valid against the schemas and are marshalled
+// the same way again after unmarshalling, in both enum formats
+func TestJSONRoundTrip(t *testing.T) {
+	replay := testReplay(300)
+	events := NewReplayEvents(replay)
+
+	values := map[string]any{
+		"replay.schema.json":        replay,
+		"replay-events.schema.json": events,
+		"replay-stats.schema.json":  NewReplayStats(events),
+	}
+
+	formats := map[string]EnumFormat{"numeric enums": NumericEnums, "string enums": StringEnums}
+
+	for formatName, format := range formats {
+		for file, value := range values {
+			t.Run(fmt.Sprintf("%v %v", file, formatName), func(t *testing.T) {
+				data, err := MarshalJSON(value, JSONEnumFormat(format))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err = validateJSON(t, file, data); err != nil {
+					t.Fatal(err)
+				}
+
+				unmarshalled := reflect.New(reflect.TypeOf(value).Elem())
+				if err = json.Unmarshal(data, unmarshalled.Interface()); err != nil {
+					t.Fatal(err)
+				}
+
+				again, err := MarshalJSON(unmarshalled.Interface(), JSONEnumFormat(format))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !bytes.Equal(again, data) {
+					t.Errorf("marshalled differently after unmarshalling")
+				}
+			})
+		}
+	}
+}
+
+func validateJSON(t *testing.T, file string, data []byte) error {
+	schemaData, err := os.ReadFile(filepath.Join("..", "schema", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var root map[string]any
+	if err = json.Unmarshal(schemaData, &root); err != nil {
+		t.Fatal(err)
+	}
+
+	var value any
+	if err = json.Unmarshal(data, &value); err != nil {
+		t.Fatal(err)
+	}
+
+	return validateSchema(root, root, value, "")
+}
+
+// validateSchema supports the subset of JSON Schema the schema package generates
+func validateSchema(root map[string]any, schema map[string]any, value any, path string) error {
+	if ref, found := schema["$ref"].(string); found {
+		defs, _ := root["$defs"].(map[string]any)
+		def, found := defs[strings.TrimPrefix(ref, "#/$defs/")].(map[string]any)
+		if !found {
+			return fmt.Errorf("%v: unknown reference %v", path, ref)
+		}
+
+		return validateSchema(root, def, value, path)
+	}
+
+	if oneOf, found := schema["oneOf"].([]any); found {
+		matched := 0
+		for _, option := range oneOf {
+			if validateSchema(root, option.(map[string]any), value, path) == nil {
+				matched++
+			}
+		}
+
+		if matched != 1 {
+			return fmt.Errorf("%v: %v matches %v schemas of oneOf", path, value, matched)
+		}
+	}
+
+	if types, found := schema["type"]; found {
+		if err := validateType(types, value, path); err != nil {
+			return err
+		}
+	}
+
+	if enum, found := schema["enum"].([]any); found {
+		valid := false
+		for _, allowed := range enum {
+			valid = valid || reflect.DeepEqual(allowed, value)
+		}
+
+		if !valid {
+			return fmt.Errorf("%v: %v is not one of %v", path, value, enum)
+		}
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		return validateObject(root, schema, value, path)
+
+	case []any:
+		if min, found := schema["minItems"].(float64); found && float64(len(value)) < min {
+			return fmt.Errorf("%v: %v items, minimum is %v", path, len(value), min)
+		}
+
+		if max, found := schema["maxItems"].(float64); found && float64(len(value)) > max {
+			return fmt.Errorf("%v: %v items, maximum is %v", path, len(value), max)
+		}
+
+		if items, found := schema["items"].(map[string]any); found {
+			for i, item := range value {
+				if err := validateSchema(root, items, item, fmt.Sprintf("%v[%v]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateObject(root map[string]any, schema map[string]any, value map[string]any, path string) error {
+	properties, _ := schema["properties"].(map[string]any)
+
+	required, _ := schema["required"].([]any)
+	for _, name := range required {
+		if _, found := value[name.(string)]; !found {
+			return fmt.Errorf("%v: missing %v", path, name)
+		}
+	}
+
+	for name, property := range value {
+		propertySchema, found := properties[name].(map[string]any)
+		if !found {
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					return fmt.Errorf("%v: unknown property %v", path, name)
+				}
+
+				continue
+			case map[string]any:
+				propertySchema = additional
+			default:
+				continue
+			}
+		}
+
+		if err := validateSchema(root, propertySchema, property, path+"."+name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateType(types any, value any, path string) error {
+	allowed, isList := types.([]any)
+	if !isList {
+		allowed = []any{types}
+	}
+
+	for _, name := range allowed {
+		if hasJSONType(name.(string), value) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%v: %v is not of type %v", path, value, types)
+}
+
+func hasJSONType(name string, value any) bool {
+	switch value := value.(type) {
+	case nil:
+		return name == "null"
+	case bool:
+		return name == "boolean"
+	case string:
+		return name == "string"
+	case float64:
+		return name == "number" || name == "integer" && value == math.Trunc(value)
+	case []any:
+		return name == "array"
+	case map[string]any:
+		return name == "object"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,104 @@
+package bsor
+
+import "fmt"
+
+var ErrLimitExceeded = Error{"limit exceeded"}
+
+// Limits protect against replays declaring huge element counts or string lengths. Every limit
+// is checked before memory is allocated, zero or negative value disables the given limit.
+type Limits struct {
+	MaxFrames            int
+	MaxNotes             int
+	MaxWalls             int
+	MaxHeights           int
+	MaxPauses            int
+	MaxCustomDataEntries int
+	MaxCustomDataLength  int
+	MaxStringLength      int
+	MaxTotalBytes        int64
+}
+
+var DefaultLimits = Limits{
+	MaxFrames:            2_000_000,
+	MaxNotes:             200_000,
+	MaxWalls:             100_000,
+	MaxHeights:           1_000_000,
+	MaxPauses:            100_000,
+	MaxCustomDataEntries: 1_000,
+	MaxCustomDataLength:  16 * 1024 * 1024,
+	MaxStringLength:      64 * 1024,
+	MaxTotalBytes:        512 * 1024 * 1024,
+}
+
+var NoLimits = Limits{}
+
+func WithLimits(limits Limits) ReadOption {
+	return func(opts *readOptions) {
+		opts.limits = limits
+	}
+}
+
+func limitError(what string, value int64, max int64) error {
+	return fmt.Errorf("%w: %v %v, max %v", ErrLimitExceeded, value, what, max)
+}
+
+func (limits *Limits) forPart(partType PartType) (what string, max int, minElementSize int) {
+	switch partType {
+	case FramesPart:
+		return "frames", limits.MaxFrames, frameSize
+	case NotesPart:
+		return "notes", limits.MaxNotes, minNoteSize
+	case WallsPart:
+		return "walls", limits.MaxWalls, wallSize
+	case HeightsPart:
+		return "heights", limits.MaxHeights, heightSize
+	case PausesPart:
+		return "pauses", limits.MaxPauses, pauseSize
+	case CustomDataPart:
+		return "custom data entries", limits.MaxCustomDataEntries, minCustomDataSize
+	default:
+		return "elements", 0, 0
+	}
+}
+
+func readPartCount(reader *decodeReader, partType PartType) (int, error) {
+	what, max, minElementSize := reader.limits.forPart(partType)
+
+	return readCount(reader, what, max, minElementSize)
+}
+
+// readCount reads element count of the part and validates it against the limit, minElementSize
+// is the smallest possible encoded size of the element used to check the total bytes limit
+func readCount(reader *decodeReader, what string, max int, minElementSize int) (int, error) {
+	count, err := readBsorInt(reader.field("count"))
+	if err != nil {
+		return 0, err
+	}
+
+	if count < 0 {
+		return 0, reader.fieldError(ErrInvalidLength)
+	}
+
+	if max > 0 && int(count) > max {
+		return 0, reader.fieldError(limitError(what, int64(count), int64(max)))
+	}
+
+	if err = reader.checkRemaining(int64(count) * int64(minElementSize)); err != nil {
+		return 0, reader.fieldError(err)
+	}
+
+	return int(count), nil
+}
+
+// checkLength validates length of a string or byte array before it is allocated
+func checkLength(reader *decodeReader, what string, length int, max int) error {
+	if length < 0 {
+		return ErrInvalidLength
+	}
+
+	if max > 0 && length > max {
+		return limitError(what, int64(length), int64(max))
+	}
+
+	return reader.checkRemaining(int64(length))
+}
@@ -0,0 +1,129 @@
+package bsor
+
+import "strings"
+
+// Modifier is a gameplay modifier code as stored in replays.
+type Modifier string
+
+const (
+	DisappearingArrows Modifier = "DA"
+	FasterSong         Modifier = "FS"
+	SuperFastSong      Modifier = "SF"
+	SlowerSong         Modifier = "SS"
+	GhostNotes         Modifier = "GN"
+	NoArrows           Modifier = "NA"
+	NoBombs            Modifier = "NB"
+	NoFail             Modifier = "NF"
+	NoObstacles        Modifier = "NO"
+	ProMode            Modifier = "PM"
+	SmallCubes         Modifier = "SC"
+	StrictAngles       Modifier = "SA"
+	OldDots            Modifier = "OD"
+	OneLife            Modifier = "IF"
+	FourLives          Modifier = "BE"
+)
+
+// score multipliers of the game are added to 1, modifiers missing here do not change the score
+var modifierMultipliers = map[Modifier]ReplayFloat{
+	DisappearingArrows: 0.07,
+	FasterSong:         0.08,
+	SuperFastSong:      0.1,
+	SlowerSong:         -0.3,
+	GhostNotes:         0.11,
+	NoArrows:           -0.3,
+	NoBombs:            -0.1,
+	NoFail:             -0.5,
+	NoObstacles:        -0.05,
+}
+
+var modifierNames = map[Modifier]string{
+	DisappearingArrows: "DisappearingArrows",
+	FasterSong:         "FasterSong",
+	SuperFastSong:      "SuperFastSong",
+	SlowerSong:         "SlowerSong",
+	GhostNotes:         "GhostNotes",
+	NoArrows:           "NoArrows",
+	NoBombs:            "NoBombs",
+	NoFail:             "NoFail",
+	NoObstacles:        "NoObstacles",
+	ProMode:            "ProMode",
+	SmallCubes:         "SmallCubes",
+	StrictAngles:       "StrictAngles",
+	OldDots:            "OldDots",
+	OneLife:            "OneLife",
+	FourLives:          "FourLives",
+}
+
+// ParseModifiers splits comma separated modifier codes, as stored in replays.
+func ParseModifiers(csv string) []Modifier {
+	if csv == "" {
+		return []Modifier{}
+	}
+
+	codes := strings.Split(csv, ",")
+
+	modifiers := make([]Modifier, len(codes))
+	for i, code := range codes {
+		modifiers[i] = Modifier(code)
+	}
+
+	return modifiers
+}
+
+func joinModifiers(modifiers []Modifier) string {
+	codes := make([]string, len(modifiers))
+	for i, modifier := range modifiers {
+		codes[i] = string(modifier)
+	}
+
+	return strings.Join(codes, ",")
+}
+
+// Known reports whether the modifier is one of the modifiers of the game.
+func (m Modifier) Known() bool {
+	_, known := modifierNames[m]
+
+	return known
+}
+
+// Multiplier returns the change of the score multiplier, e.g. 0.08 for FasterSong, NoFail's -0.5 applies only after a fail.
+func (m Modifier) Multiplier() ReplayFloat {
+	return modifierMultipliers[m]
+}
+
+// String returns the name of the modifier, or its code if it's unknown.
+func (m Modifier) String() string {
+	if name, known := modifierNames[m]; known {
+		return name
+	}
+
+	return string(m)
+}
+
+// HasModifier reports whether the modifier was enabled.
+func (info *Info) HasModifier(modifier Modifier) bool {
+	for _, m := range info.Modifiers {
+		if m == modifier {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ModifiersMultiplier returns the score multiplier of the modifiers, the way the game computes it. NoFail counts
+// only if the player failed, i.e. the energy reached zero.
+func ModifiersMultiplier(modifiers []Modifier, failed bool) ReplayFloat {
+	multiplier := ReplayFloat(1)
+	for _, modifier := range modifiers {
+		if modifier != NoFail || failed {
+			multiplier += modifier.Multiplier()
+		}
+	}
+
+	if multiplier < 0 {
+		return 0
+	}
+
+	return multiplier
+}
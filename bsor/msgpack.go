@@ -0,0 +1,56 @@
+package bsor
+
+import (
+	"io"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MsgpackPayload lists the outputs which can be encoded as MessagePack.
+type MsgpackPayload interface {
+	ReplayEvents | ReplayStats | ReplayEventsWithStats
+}
+
+type MsgpackOption func(*msgpackOptions)
+
+type msgpackOptions struct {
+	arrayStructs bool
+}
+
+// MsgpackArrayStructs encodes structs as arrays of field values in declaration order instead of maps,
+// which leaves field names out of the payload. Decoders have to know the field order then.
+func MsgpackArrayStructs() MsgpackOption {
+	return func(opts *msgpackOptions) {
+		opts.arrayStructs = true
+	}
+}
+
+// EncodeMsgpack writes the value as MessagePack. Maps use the same keys as JSON output,
+// integers and floats are stored in the smallest type which keeps their value.
+func EncodeMsgpack[T MsgpackPayload](writer io.Writer, value *T, options ...MsgpackOption) error {
+	opts := &msgpackOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	encoder := msgpack.NewEncoder(writer)
+	encoder.SetCustomStructTag("json")
+	encoder.UseCompactInts(true)
+	encoder.UseCompactFloats(true)
+	encoder.UseArrayEncodedStructs(opts.arrayStructs)
+
+	return encoder.Encode(value)
+}
+
+// DecodeMsgpack reads the value encoded by EncodeMsgpack, with or without MsgpackArrayStructs.
+func DecodeMsgpack[T MsgpackPayload](reader io.Reader) (*T, error) {
+	decoder := msgpack.NewDecoder(reader)
+	decoder.SetCustomStructTag("json")
+
+	var value T
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return &value, nil
+}
@@ -0,0 +1,49 @@
+package bsor
+
+type ReadOption func(*readOptions)
+
+type readOptions struct {
+	lenient  bool
+	limits   Limits
+	progress func(Progress)
+	workers  int
+}
+
+func newReadOptions(options []ReadOption) *readOptions {
+	opts := &readOptions{limits: DefaultLimits}
+
+	for _, option := range options {
+		option(opts)
+	}
+
+	return opts
+}
+
+// Lenient makes Read return the partially decoded replay instead of failing on the first error.
+func Lenient() ReadOption {
+	return func(opts *readOptions) {
+		opts.lenient = true
+	}
+}
+
+// Progress is reported when a part starts and periodically while it is decoded.
+// Done is set in the last report, after the whole replay was read.
+type Progress struct {
+	Bytes int64    `json:"bytes"`
+	Part  PartType `json:"part"`
+	Done  bool     `json:"done"`
+}
+
+func WithProgress(callback func(Progress)) ReadOption {
+	return func(opts *readOptions) {
+		opts.progress = callback
+	}
+}
+
+// WithWorkers sets the number of files ReadFS and StreamFS decode at once, by default it is GOMAXPROCS.
+// Other functions ignore it. A WithProgress callback is then called concurrently for different files.
+func WithWorkers(workers int) ReadOption {
+	return func(opts *readOptions) {
+		opts.workers = workers
+	}
+}
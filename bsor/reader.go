@@ -0,0 +1,193 @@
+package bsor
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+)
+
+const lookaheadSize = 64 * 1024
+
+// decodeReader tracks the number of consumed bytes and the field being decoded,
+// so errors can point at the exact place where the replay is broken. It also buffers
+// the underlying reader, so the decoder can look ahead regardless of the reader type.
+type decodeReader struct {
+	reader   io.Reader
+	buffered *bufio.Reader
+	// data is decoded directly when the whole replay is in memory, offset is the read position then
+	data        []byte
+	inMemory    bool
+	offset      int64
+	fieldName   string
+	fieldOffset int64
+	limits      Limits
+	ctx         context.Context
+	progress    func(Progress)
+	// data written by this package never needs the invalid string length heuristic
+	exactStrings bool
+}
+
+func newDecodeReader(reader io.Reader, limits Limits) *decodeReader {
+	return &decodeReader{reader: reader, buffered: bufio.NewReaderSize(reader, lookaheadSize), limits: limits}
+}
+
+func newBytesDecodeReader(data []byte, limits Limits) *decodeReader {
+	return &decodeReader{data: data, inMemory: true, limits: limits}
+}
+
+func (r *decodeReader) Read(p []byte) (n int, err error) {
+	if max := r.limits.MaxTotalBytes; max > 0 {
+		remaining := max - r.offset
+		if remaining <= 0 && len(p) > 0 {
+			return 0, limitError("bytes", r.offset+int64(len(p)), max)
+		}
+
+		if int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+	}
+
+	if r.inMemory {
+		if r.offset >= int64(len(r.data)) {
+			return 0, io.EOF
+		}
+
+		n = copy(p, r.data[r.offset:])
+		r.offset += int64(n)
+
+		return n, nil
+	}
+
+	n, err = r.buffered.Read(p)
+	r.offset += int64(n)
+
+	return
+}
+
+// peekAt returns length bytes starting at offset bytes after the current position without consuming them
+func (r *decodeReader) peekAt(offset int, length int) ([]byte, error) {
+	if offset < 0 || length < 0 || offset+length > lookaheadSize {
+		return nil, bufio.ErrBufferFull
+	}
+
+	// lookahead is limited in memory too, so both ways of reading give the same results
+	if r.inMemory {
+		if end := r.offset + int64(offset+length); end <= int64(len(r.data)) {
+			return r.data[r.offset+int64(offset) : end], nil
+		}
+
+		return nil, io.EOF
+	}
+
+	data, err := r.buffered.Peek(offset + length)
+	if err != nil {
+		return nil, err
+	}
+
+	return data[offset:], nil
+}
+
+// skip consumes number bytes, seeking the underlying reader if possible
+func (r *decodeReader) skip(number int64) error {
+	if r.inMemory && r.offset+number <= int64(len(r.data)) && r.checkRemaining(number) == nil {
+		r.offset += number
+
+		return nil
+	}
+
+	if !r.inMemory && number > int64(r.buffered.Buffered()) && r.checkRemaining(number) == nil {
+		if seeker, implementsSeeker := r.reader.(io.Seeker); implementsSeeker {
+			// seeking past the end succeeds, so the last skipped byte is read to detect truncated data
+			if _, err := seeker.Seek(number-int64(r.buffered.Buffered())-1, io.SeekCurrent); err == nil {
+				r.buffered.Reset(r.reader)
+				r.offset += number - 1
+
+				if _, err = r.buffered.ReadByte(); err != nil {
+					if err == io.EOF {
+						return io.ErrUnexpectedEOF
+					}
+
+					return err
+				}
+
+				r.offset++
+
+				return nil
+			}
+		}
+	}
+
+	// truncated data and exceeded limits are reported the same way for every reader
+	skipped, err := io.CopyN(io.Discard, r, number)
+	if skipped < number {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *decodeReader) checkRemaining(length int64) error {
+	if max := r.limits.MaxTotalBytes; max > 0 && r.offset+length > max {
+		return limitError("bytes", r.offset+length, max)
+	}
+
+	return nil
+}
+
+// number of elements decoded between checkpoints within a part
+const checkpointInterval = 4096
+
+// checkpoint reports progress and returns an error if decoding was cancelled
+func (r *decodeReader) checkpoint(part PartType) error {
+	if r.progress != nil {
+		r.progress(Progress{Bytes: r.offset, Part: part})
+	}
+
+	if r.ctx != nil && r.ctx.Err() != nil {
+		return r.field("").fieldError(r.ctx.Err())
+	}
+
+	return nil
+}
+
+func (r *decodeReader) cancelled() bool {
+	return r.ctx != nil && r.ctx.Err() != nil
+}
+
+// field marks the start of the next decoded field
+func (r *decodeReader) field(name string) *decodeReader {
+	r.fieldName = name
+	r.fieldOffset = r.offset
+
+	return r
+}
+
+func (r *decodeReader) fieldAt(name string, offset int64) *decodeReader {
+	r.fieldName = name
+	r.fieldOffset = offset
+
+	return r
+}
+
+func (r *decodeReader) fieldError(err error) *DecodeError {
+	return &DecodeError{Part: UnknownPart, Index: -1, Field: r.fieldName, Offset: r.fieldOffset, Err: err}
+}
+
+// decodeError attaches part context to err, field and offset are taken from err
+// if it is already a *DecodeError or from the last field marked otherwise
+func (r *decodeReader) decodeError(part PartType, index int, err error) *DecodeError {
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		decodeErr = r.fieldError(err)
+	}
+
+	decodeErr.Part = part
+	decodeErr.Index = index
+
+	return decodeErr
+}
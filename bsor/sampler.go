@@ -0,0 +1,158 @@
+package bsor
+
+import (
+	"math"
+	"sort"
+)
+
+// frames further apart are not interpolated by default, the replay lost some frames there
+const defaultMaxFrameGap = 0.25
+
+type SamplerOption func(*FrameSampler)
+
+// MaxFrameGap sets the longest time between two frames which is still interpolated.
+func MaxFrameGap(gap TimeValue) SamplerOption {
+	return func(sampler *FrameSampler) {
+		sampler.maxGap = gap
+	}
+}
+
+// FrameSampler returns poses at any time of the replay, interpolating positions linearly
+// and rotations with slerp between the nearest frames. It is safe for concurrent use.
+type FrameSampler struct {
+	frames []Frame
+	pauses []TimeValue
+	maxGap TimeValue
+}
+
+// NewFrameSampler prepares frames of the replay for sampling. Frames which do not move forward in time
+// are skipped, the first one of them is kept.
+func NewFrameSampler(replay *Replay, options ...SamplerOption) *FrameSampler {
+	sampler := &FrameSampler{
+		frames: make([]Frame, 0, len(replay.Frames)),
+		pauses: make([]TimeValue, 0, len(replay.Pauses)),
+		maxGap: defaultMaxFrameGap,
+	}
+
+	for _, option := range options {
+		option(sampler)
+	}
+
+	for i := range replay.Frames {
+		frame := &replay.Frames[i]
+
+		if math.IsNaN(float64(frame.Time)) {
+			continue
+		}
+
+		if count := len(sampler.frames); count > 0 && frame.Time <= sampler.frames[count-1].Time {
+			continue
+		}
+
+		sampler.frames = append(sampler.frames, *frame)
+	}
+
+	for _, pause := range replay.Pauses {
+		sampler.pauses = append(sampler.pauses, pause.Time)
+	}
+
+	sort.Slice(sampler.pauses, func(i, j int) bool { return sampler.pauses[i] < sampler.pauses[j] })
+
+	return sampler
+}
+
+// HeadAt returns the head pose at the time. The result is not ok if the time is out of the recorded frames
+// or in a gap longer than the max frame gap, the pose of the nearest frame is returned then.
+func (sampler *FrameSampler) HeadAt(t TimeValue) (PositionAndRotation, bool) {
+	return sampler.poseAt(t, func(frame *Frame) *PositionAndRotation { return &frame.Head })
+}
+
+// LeftHandAt works like HeadAt for the left hand.
+func (sampler *FrameSampler) LeftHandAt(t TimeValue) (PositionAndRotation, bool) {
+	return sampler.poseAt(t, func(frame *Frame) *PositionAndRotation { return &frame.LeftHand })
+}
+
+// RightHandAt works like HeadAt for the right hand.
+func (sampler *FrameSampler) RightHandAt(t TimeValue) (PositionAndRotation, bool) {
+	return sampler.poseAt(t, func(frame *Frame) *PositionAndRotation { return &frame.RightHand })
+}
+
+// FrameAt returns all the poses at the time, with fps of the preceding frame, ok is the same as of HeadAt.
+func (sampler *FrameSampler) FrameAt(t TimeValue) (Frame, bool) {
+	var frame Frame
+	var ok bool
+
+	frame.Head, ok = sampler.HeadAt(t)
+	frame.LeftHand, _ = sampler.LeftHandAt(t)
+	frame.RightHand, _ = sampler.RightHandAt(t)
+	frame.Time = t
+
+	if before, after, found := sampler.neighbours(t); before != nil {
+		frame.Fps = before.Fps
+	} else if found {
+		frame.Fps = after.Fps
+	}
+
+	return frame, ok
+}
+
+// neighbours returns the last frame at or before t and the first one after it
+func (sampler *FrameSampler) neighbours(t TimeValue) (*Frame, *Frame, bool) {
+	count := len(sampler.frames)
+	if count == 0 {
+		return nil, nil, false
+	}
+
+	idx := sort.Search(count, func(i int) bool { return sampler.frames[i].Time > t })
+
+	switch idx {
+	case 0:
+		return nil, &sampler.frames[0], true
+	case count:
+		return &sampler.frames[count-1], nil, true
+	default:
+		return &sampler.frames[idx-1], &sampler.frames[idx], true
+	}
+}
+
+// pauseBetween returns the time of a pause in the [from, to) range
+func (sampler *FrameSampler) pauseBetween(from TimeValue, to TimeValue) (TimeValue, bool) {
+	idx := sort.Search(len(sampler.pauses), func(i int) bool { return sampler.pauses[i] >= from })
+	if idx < len(sampler.pauses) && sampler.pauses[idx] < to {
+		return sampler.pauses[idx], true
+	}
+
+	return 0, false
+}
+
+func (sampler *FrameSampler) poseAt(t TimeValue, pose func(*Frame) *PositionAndRotation) (PositionAndRotation, bool) {
+	before, after, found := sampler.neighbours(t)
+
+	switch {
+	case !found:
+		return PositionAndRotation{}, false
+	case before == nil:
+		return *pose(after), false
+	case after == nil:
+		return *pose(before), t == before.Time
+	}
+
+	// the player moves during the pause while the song time stands still, poses on both sides are unrelated
+	if pause, paused := sampler.pauseBetween(before.Time, after.Time); paused {
+		if t < pause {
+			return *pose(before), true
+		}
+
+		return *pose(after), true
+	}
+
+	if after.Time-before.Time > sampler.maxGap {
+		if t-before.Time <= after.Time-t {
+			return *pose(before), false
+		}
+
+		return *pose(after), false
+	}
+
+	return interpolatePose(pose(before), pose(after), float64(t-before.Time)/float64(after.Time-before.Time)), true
+}
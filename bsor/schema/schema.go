@@ -0,0 +1,240 @@
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Typer is implemented by types whose JSON form is not derived from their Go type, e.g. enums
+// with custom marshalling. The returned schema is used as it is.
+type Typer interface {
+	JSONSchema() map[string]any
+}
+
+var typerType = reflect.TypeOf((*Typer)(nil)).Elem()
+var timeType = reflect.TypeOf(time.Time{})
+var invalidNameChars = regexp.MustCompile(`[^A-Za-z0-9_.]+`)
+
+type generator struct {
+	defs map[string]any
+}
+
+// Generate returns JSON Schema describing the JSON encoding of value, following the json struct tags.
+// Named struct types are placed in $defs, so shared types are described only once.
+func Generate(value any, title string) ([]byte, error) {
+	g := &generator{defs: map[string]any{}}
+
+	schema := g.schema(reflect.TypeOf(value))
+	schema["$schema"] = draft
+	schema["title"] = title
+	if len(g.defs) > 0 {
+		schema["$defs"] = g.defs
+	}
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func (g *generator) schema(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		return g.schema(t.Elem())
+	}
+
+	if t.Implements(typerType) {
+		return reflect.Zero(t).Interface().(Typer).JSONSchema()
+	}
+
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+
+	case reflect.String:
+		return map[string]any{"type": "string"}
+
+	case reflect.Slice, reflect.Array:
+		// byte slices are encoded as base64 strings, nil ones as null, byte arrays are encoded as arrays
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 && !t.Elem().Implements(typerType) {
+			return map[string]any{"type": []string{"string", "null"}, "contentEncoding": "base64"}
+		}
+
+		items := g.schema(t.Elem())
+		if t.Kind() == reflect.Slice {
+			// nil slices are encoded as null
+			return map[string]any{"type": []string{"array", "null"}, "items": items}
+		}
+
+		return map[string]any{"type": "array", "items": items, "minItems": t.Len(), "maxItems": t.Len()}
+
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+
+		name := defName(t)
+		if _, found := g.defs[name]; !found {
+			// placeholder stops the recursion on self-referencing types
+			g.defs[name] = map[string]any{}
+			g.defs[name] = g.object(t)
+		}
+
+		return map[string]any{"$ref": "#/$defs/" + name}
+
+	default:
+		return map[string]any{}
+	}
+}
+
+func defName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if index := strings.LastIndex(pkg, "/"); index >= 0 {
+		pkg = pkg[index+1:]
+	}
+
+	return strings.Trim(invalidNameChars.ReplaceAllString(pkg+"."+t.Name(), "_"), "_")
+}
+
+type field struct {
+	name      string
+	depth     int
+	tagged    bool
+	omitEmpty bool
+	fieldType reflect.Type
+}
+
+func (g *generator) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+
+	for _, f := range visibleFields(t) {
+		properties[f.name] = g.schema(f.fieldType)
+		if !f.omitEmpty {
+			required = append(required, f.name)
+		}
+	}
+
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// visibleFields resolves fields of embedded structs the way encoding/json does
+func visibleFields(t reflect.Type) []field {
+	var fields []field
+	collectFields(t, 0, &fields)
+
+	byName := map[string][]field{}
+	var order []string
+	for _, f := range fields {
+		if _, found := byName[f.name]; !found {
+			order = append(order, f.name)
+		}
+
+		byName[f.name] = append(byName[f.name], f)
+	}
+
+	var visible []field
+	for _, name := range order {
+		if dominant, ok := dominantField(byName[name]); ok {
+			visible = append(visible, dominant)
+		}
+	}
+
+	return visible
+}
+
+func collectFields(t reflect.Type, depth int, fields *[]field) {
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+
+		tag := structField.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+
+		fieldType := structField.Type
+		if structField.Anonymous && name == "" {
+			if fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+
+			if fieldType.Kind() == reflect.Struct {
+				collectFields(fieldType, depth+1, fields)
+
+				continue
+			}
+		}
+
+		if !structField.IsExported() {
+			continue
+		}
+
+		tagged := name != ""
+		if !tagged {
+			name = structField.Name
+		}
+
+		*fields = append(*fields, field{
+			name:      name,
+			depth:     depth,
+			tagged:    tagged,
+			omitEmpty: strings.Contains(","+options+",", ",omitempty,"),
+			fieldType: structField.Type,
+		})
+	}
+}
+
+// dominantField picks the shallowest field, tagged one wins on the same depth, ambiguous fields are dropped
+func dominantField(fields []field) (field, bool) {
+	depth := fields[0].depth
+	var candidates []field
+	for _, f := range fields {
+		if f.depth < depth {
+			depth = f.depth
+			candidates = nil
+		}
+
+		if f.depth == depth {
+			candidates = append(candidates, f)
+		}
+	}
+
+	if len(candidates) == 1 {
+		return candidates[0], true
+	}
+
+	var tagged []field
+	for _, f := range candidates {
+		if f.tagged {
+			tagged = append(tagged, f)
+		}
+	}
+
+	if len(tagged) == 1 {
+		return tagged[0], true
+	}
+
+	return field{}, false
+}
@@ -79,6 +79,8 @@ type ReplayStatsInfo struct {
 	Info
 	EndTime      TimeValue  `json:"endTime"`
 	CalcScore    Score      `json:"calcScore"`
+	BaseScore    Score      `json:"baseScore"`
+	MaxScore     Score      `json:"maxScore"`
 	Accuracy     SwingValue `json:"accuracy"`
 	CalcAccuracy SwingValue `json:"calcAccuracy"`
 	FcAccuracy   SwingValue `json:"fcAccuracy"`
@@ -216,6 +218,8 @@ func newStatInfo(info *ReplayEventsInfo) *ReplayStatsInfo {
 		CalcAccuracy: info.CalcAccuracy,
 		FcAccuracy:   info.FcAccuracy,
 		CalcScore:    info.CalcScore,
+		BaseScore:    info.BaseScore,
+		MaxScore:     info.MaxScore,
 		WallHits:     0,
 		Pauses:       0,
 	}
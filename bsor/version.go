@@ -0,0 +1,193 @@
+package bsor
+
+import "sync"
+
+// BuiltinVersion is the BSOR version whose layout is known to Decoder, Index and Write.
+const BuiltinVersion Version = 1
+
+// PartDecoder decodes a single part into the replay, the part type has already been read.
+type PartDecoder func(reader *PartReader, replay *Replay) error
+
+// VersionDecoder describes the layout of a BSOR version by decoders of the parts it consists of.
+type VersionDecoder struct {
+	Parts map[PartType]PartDecoder
+}
+
+var versionsMu sync.RWMutex
+var versions = map[Version]VersionDecoder{
+	BuiltinVersion: {Parts: map[PartType]PartDecoder{
+		InfoPart: func(reader *PartReader, replay *Replay) error {
+			return readInfo(reader.reader, &replay.Info)
+		},
+		FramesPart: func(reader *PartReader, replay *Replay) error {
+			return readWholeSlice(reader.reader, FramesPart, &replay.Frames, frameSize, decodeFrame)
+		},
+		NotesPart: func(reader *PartReader, replay *Replay) error {
+			return readNotes(reader.reader, &replay.Notes)
+		},
+		WallsPart: func(reader *PartReader, replay *Replay) error {
+			return readWalls(reader.reader, &replay.Walls)
+		},
+		HeightsPart: func(reader *PartReader, replay *Replay) error {
+			return readWholeSlice(reader.reader, HeightsPart, &replay.Heights, heightSize, decodeHeight)
+		},
+		PausesPart: func(reader *PartReader, replay *Replay) error {
+			return readWholeSlice(reader.reader, PausesPart, &replay.Pauses, pauseSize, decodePause)
+		},
+		ControllerOffsetsPart: func(reader *PartReader, replay *Replay) error {
+			replay.ControllerOffsets = &ControllerOffsets{}
+			if err := readElement(reader.reader.field(""), controllerOffsetsSize, decodeControllerOffsets, replay.ControllerOffsets); err != nil {
+				replay.ControllerOffsets = nil
+
+				return err
+			}
+
+			return nil
+		},
+		CustomDataPart: func(reader *PartReader, replay *Replay) error {
+			return readCustomData(reader.reader, &replay.CustomData)
+		},
+	}},
+}
+
+// RegisterVersion adds support for reading replays of the given version or replaces the existing one.
+// Layouts based on an existing version can start with a copy returned by LookupVersion.
+func RegisterVersion(version Version, decoder VersionDecoder) {
+	versionsMu.Lock()
+	defer versionsMu.Unlock()
+
+	versions[version] = decoder.clone()
+}
+
+// LookupVersion returns a copy of the registered version decoder, so it can be safely modified.
+func LookupVersion(version Version) (VersionDecoder, bool) {
+	versionsMu.RLock()
+	defer versionsMu.RUnlock()
+
+	decoder, found := versions[version]
+	if !found {
+		return VersionDecoder{}, false
+	}
+
+	return decoder.clone(), true
+}
+
+func (decoder VersionDecoder) clone() VersionDecoder {
+	parts := make(map[PartType]PartDecoder, len(decoder.Parts))
+	for partType, partDecoder := range decoder.Parts {
+		parts[partType] = partDecoder
+	}
+
+	return VersionDecoder{Parts: parts}
+}
+
+func lookupPartDecoder(version Version, partType PartType) (PartDecoder, bool) {
+	versionsMu.RLock()
+	defer versionsMu.RUnlock()
+
+	decoder, found := versions[version].Parts[partType]
+
+	return decoder, found
+}
+
+func isVersionRegistered(version Version) bool {
+	versionsMu.RLock()
+	defer versionsMu.RUnlock()
+
+	_, found := versions[version]
+
+	return found
+}
+
+// PartReader gives part decoders access to the replay data. Read values are validated against
+// the same limits as built-in parts and errors point at the field marked with Field.
+type PartReader struct {
+	reader *decodeReader
+}
+
+// Field marks the start of the next field, so decode errors can point at it.
+func (r *PartReader) Field(name string) *PartReader {
+	r.reader.field(name)
+
+	return r
+}
+
+// Offset returns the number of bytes read from the start of the replay.
+func (r *PartReader) Offset() int64 {
+	return r.reader.offset
+}
+
+func (r *PartReader) ReadInt() (ReplayInt, error) {
+	return readBsorInt(r.reader)
+}
+
+func (r *PartReader) ReadFloat() (ReplayFloat, error) {
+	return r.reader.readFloat()
+}
+
+func (r *PartReader) ReadByte() (byte, error) {
+	return r.reader.readByte()
+}
+
+func (r *PartReader) ReadBool() (bool, error) {
+	return r.reader.readBool()
+}
+
+func (r *PartReader) ReadString() (string, error) {
+	return readString(r.reader)
+}
+
+// ReadPotentiallyInvalidString reads a string the way Info strings are read, recovering from lengths
+// some versions of the mod wrote incorrectly.
+func (r *PartReader) ReadPotentiallyInvalidString() (string, error) {
+	return readPotentiallyInvalidString(r.reader)
+}
+
+func (r *PartReader) ReadBytes(number int) ([]byte, error) {
+	if err := checkLength(r.reader, "bytes", number, r.reader.limits.MaxCustomDataLength); err != nil {
+		return nil, r.reader.fieldError(err)
+	}
+
+	return readBytes(r.reader, number)
+}
+
+// ReadCount reads element count of the part, validated against limits of the part type.
+func (r *PartReader) ReadCount(partType PartType) (int, error) {
+	return readPartCount(r.reader, partType)
+}
+
+func (r *PartReader) Skip(number int64) error {
+	return skipBytes(r.reader, number)
+}
+
+func (r *PartReader) ReadInfo(info *Info) error {
+	return readInfo(r.reader, info)
+}
+
+func (r *PartReader) ReadFrame(frame *Frame) error {
+	return readFrame(r.reader, frame)
+}
+
+func (r *PartReader) ReadNote(note *Note) error {
+	return readNote(r.reader, note)
+}
+
+func (r *PartReader) ReadWall(wall *WallHit) error {
+	return readWall(r.reader, wall)
+}
+
+func (r *PartReader) ReadHeight(height *AutomaticHeight) error {
+	return readHeight(r.reader, height)
+}
+
+func (r *PartReader) ReadPause(pause *Pause) error {
+	return readPause(r.reader, pause)
+}
+
+func (r *PartReader) ReadControllerOffsets(offsets *ControllerOffsets) error {
+	return readElement(r.reader.field(""), controllerOffsetsSize, decodeControllerOffsets, offsets)
+}
+
+func (r *PartReader) ReadCustomDataEntry(entry *CustomData) error {
+	return readCustomDataEntry(r.reader, entry)
+}
@@ -0,0 +1,94 @@
+package bsor
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type testExtension struct {
+	Value ReplayInt
+	Name  string
+	Info  Info
+	Notes []Note
+}
+
+const testExtensionPart PartType = 8
+
+func TestRegisterVersion(t *testing.T) {
+	const version Version = 200
+
+	layout, _ := LookupVersion(BuiltinVersion)
+	layout.Parts[testExtensionPart] = func(reader *PartReader, replay *Replay) (err error) {
+		var extension testExtension
+		if extension.Value, err = reader.Field("value").ReadInt(); err != nil {
+			return err
+		}
+
+		if extension.Name, err = reader.Field("name").ReadPotentiallyInvalidString(); err != nil {
+			return err
+		}
+
+		if err = reader.ReadInfo(&extension.Info); err != nil {
+			return err
+		}
+
+		count, err := reader.ReadCount(NotesPart)
+		if err != nil {
+			return err
+		}
+
+		extension.Notes = make([]Note, count)
+		for i := range extension.Notes {
+			if err = reader.ReadNote(&extension.Notes[i]); err != nil {
+				return err
+			}
+		}
+
+		replay.Extensions = map[PartType]any{testExtensionPart: extension}
+
+		return nil
+	}
+
+	RegisterVersion(version, layout)
+
+	original := testReplay(100)
+	want := testExtension{Value: 42, Name: "extension", Info: original.Info, Notes: original.Notes[:2]}
+
+	data := bytes.NewBuffer(writeReplay(t, original))
+	data.Bytes()[4] = version
+
+	if err := writePartType(data, testExtensionPart); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeBsorInt(data, want.Value); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeString(data, want.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeInfo(data, &want.Info); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeNotes(data, want.Notes); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if extension := replay.Extensions[testExtensionPart]; !reflect.DeepEqual(extension, want) {
+		t.Errorf("got extension %+v, want %+v", extension, want)
+	}
+
+	replay.Version, replay.Extensions = BuiltinVersion, nil
+	if !reflect.DeepEqual(replay, original) {
+		t.Errorf("built-in parts of the replay differ from the written ones")
+	}
+}
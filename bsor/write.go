@@ -0,0 +1,321 @@
+package bsor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+func wrapWriteError(err error) error {
+	return fmt.Errorf("bsor write error: %w", err)
+}
+
+// Write encodes the replay in the layout of BuiltinVersion, replays of other versions
+// result in ErrUnknownBsorVersion. A replay read by Read is written back as the same bytes, unless its
+// strings needed fixing of invalid lengths, or note ids are out of -1289999..1279999 or wall ids out of
+// -12899..12799 range, e.g. for walls of mapping extensions. Parts of such ids do not fit into byte fields.
+func Write(writer io.Writer, replay *Replay) error {
+	if replay.Version != BuiltinVersion {
+		return wrapWriteError(ErrUnknownBsorVersion)
+	}
+
+	if err := writeHeader(writer, &replay.Header); err != nil {
+		return wrapWriteError(err)
+	}
+
+	if err := writePartType(writer, InfoPart); err != nil {
+		return wrapWriteError(err)
+	}
+	if err := writeInfo(writer, &replay.Info); err != nil {
+		return wrapWriteError(err)
+	}
+
+	if err := writePartType(writer, FramesPart); err != nil {
+		return wrapWriteError(err)
+	}
+	if err := writeWholeSlice(writer, replay.Frames); err != nil {
+		return wrapWriteError(err)
+	}
+
+	if err := writePartType(writer, NotesPart); err != nil {
+		return wrapWriteError(err)
+	}
+	if err := writeNotes(writer, replay.Notes); err != nil {
+		return wrapWriteError(err)
+	}
+
+	if err := writePartType(writer, WallsPart); err != nil {
+		return wrapWriteError(err)
+	}
+	if err := writeWalls(writer, replay.Walls); err != nil {
+		return wrapWriteError(err)
+	}
+
+	if err := writePartType(writer, HeightsPart); err != nil {
+		return wrapWriteError(err)
+	}
+	if err := writeWholeSlice(writer, replay.Heights); err != nil {
+		return wrapWriteError(err)
+	}
+
+	if err := writePartType(writer, PausesPart); err != nil {
+		return wrapWriteError(err)
+	}
+	if err := writeWholeSlice(writer, replay.Pauses); err != nil {
+		return wrapWriteError(err)
+	}
+
+	if replay.ControllerOffsets != nil {
+		if err := writePartType(writer, ControllerOffsetsPart); err != nil {
+			return wrapWriteError(err)
+		}
+		if err := writeAny(writer, replay.ControllerOffsets); err != nil {
+			return wrapWriteError(err)
+		}
+	}
+
+	if replay.CustomData != nil {
+		if err := writePartType(writer, CustomDataPart); err != nil {
+			return wrapWriteError(err)
+		}
+		if err := writeCustomData(writer, replay.CustomData); err != nil {
+			return wrapWriteError(err)
+		}
+	}
+
+	return nil
+}
+
+func writePartType(writer io.Writer, partType PartType) error {
+	_, err := writer.Write([]byte{byte(partType)})
+
+	return err
+}
+
+func writeHeader(writer io.Writer, header *Header) error {
+	// magic is not a part of JSON output, so it's always written regardless of the value in the header
+	return writeAny(writer, &Header{Magic: bsorMagic, Version: header.Version})
+}
+
+func writeInfo(writer io.Writer, info *Info) (err error) {
+	if err = writeString(writer, info.ModVersion); err != nil {
+		return err
+	}
+
+	if err = writeString(writer, info.GameVersion); err != nil {
+		return err
+	}
+
+	if err = writeString(writer, strconv.FormatInt(info.TimeSet.Unix(), 10)); err != nil {
+		return err
+	}
+
+	if err = writeString(writer, info.PlayerId); err != nil {
+		return err
+	}
+
+	if err = writeString(writer, info.PlayerName); err != nil {
+		return err
+	}
+
+	if err = writeString(writer, info.Platform); err != nil {
+		return err
+	}
+
+	if err = writeString(writer, info.TrackingSystem); err != nil {
+		return err
+	}
+
+	if err = writeString(writer, info.Hmd); err != nil {
+		return err
+	}
+
+	if err = writeString(writer, info.Controller); err != nil {
+		return err
+	}
+
+	if err = writeString(writer, info.Hash); err != nil {
+		return err
+	}
+
+	if err = writeString(writer, info.SongName); err != nil {
+		return err
+	}
+
+	if err = writeString(writer, info.Mapper); err != nil {
+		return err
+	}
+
+	if err = writeString(writer, info.Difficulty); err != nil {
+		return err
+	}
+
+	if err = writeAny(writer, info.Score); err != nil {
+		return err
+	}
+
+	if err = writeString(writer, info.Mode); err != nil {
+		return err
+	}
+
+	if err = writeString(writer, info.Environment); err != nil {
+		return err
+	}
+
+	if err = writeString(writer, joinModifiers(info.Modifiers)); err != nil {
+		return err
+	}
+
+	if err = writeAny(writer, info.JumpDistance); err != nil {
+		return err
+	}
+
+	if err = writeAny(writer, info.LeftHanded); err != nil {
+		return err
+	}
+
+	if err = writeAny(writer, info.Height); err != nil {
+		return err
+	}
+
+	if err = writeAny(writer, info.StartTime); err != nil {
+		return err
+	}
+
+	if err = writeAny(writer, info.FailTime); err != nil {
+		return err
+	}
+
+	if err = writeAny(writer, info.Speed); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func writeWholeSlice[T any](writer io.Writer, slice []T) (err error) {
+	if err = writeBsorInt(writer, ReplayInt(len(slice))); err != nil {
+		return
+	}
+
+	return writeAny(writer, slice)
+}
+
+// encodeNoteId rebuilds the id the note was read from. Fields are split from the id with truncated division,
+// so all of them are negative for negative ids, stored wrapped in bytes (e.g. -1 as CutDirection 255).
+// Ids from -1289999 to 1279999 are rebuilt exactly, scoring type of other ids doesn't fit into a byte.
+func encodeNoteId(note *Note) ReplayInt {
+	return ReplayInt(int8(note.ScoringType))*10000 +
+		ReplayInt(int8(note.LineIdx))*1000 +
+		ReplayInt(int8(note.LineLayer))*100 +
+		ReplayInt(int8(note.ColorType))*10 +
+		ReplayInt(int8(note.CutDirection))
+}
+
+func writeNotes(writer io.Writer, notes []Note) (err error) {
+	if err = writeBsorInt(writer, ReplayInt(len(notes))); err != nil {
+		return
+	}
+
+	for i := range notes {
+		if err = writeBsorInt(writer, encodeNoteId(&notes[i])); err != nil {
+			return
+		}
+
+		if err = writeAny(writer, notes[i].EventTime); err != nil {
+			return
+		}
+		if err = writeAny(writer, notes[i].SpawnTime); err != nil {
+			return
+		}
+		if err = writeAny(writer, notes[i].EventType); err != nil {
+			return
+		}
+		if notes[i].EventType == Good || notes[i].EventType == Bad {
+			if err = writeAny(writer, &notes[i].CutInfo); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// encodeWallId rebuilds the wall id the same way as note ids. Ids from -12899 to 12799 are rebuilt exactly,
+// line index of other ids (walls of mapping extensions) doesn't fit into a byte.
+func encodeWallId(wall *WallHit) ReplayInt {
+	return ReplayInt(int8(wall.LineIdx))*100 +
+		ReplayInt(int8(wall.ObstacleType))*10 +
+		ReplayInt(int8(wall.Width))
+}
+
+func writeWalls(writer io.Writer, walls []WallHit) (err error) {
+	if err = writeBsorInt(writer, ReplayInt(len(walls))); err != nil {
+		return
+	}
+
+	for i := range walls {
+		if err = writeBsorInt(writer, encodeWallId(&walls[i])); err != nil {
+			return
+		}
+
+		if err = writeAny(writer, walls[i].Energy); err != nil {
+			return
+		}
+		if err = writeAny(writer, walls[i].Time); err != nil {
+			return
+		}
+		if err = writeAny(writer, walls[i].SpawnTime); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func writeCustomData(writer io.Writer, customData []CustomData) (err error) {
+	if err = writeBsorInt(writer, ReplayInt(len(customData))); err != nil {
+		return
+	}
+
+	for i := range customData {
+		if err = writeString(writer, customData[i].Key); err != nil {
+			return
+		}
+
+		if err = writeBsorInt(writer, ReplayInt(len(customData[i].Value))); err != nil {
+			return
+		}
+
+		if _, err = writer.Write(customData[i].Value); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func writeAny(writer io.Writer, data any) error {
+	return binary.Write(writer, byteOrder, data)
+}
+
+func writeBsorInt(writer io.Writer, value ReplayInt) error {
+	var intBytes [4]byte
+
+	byteOrder.PutUint32(intBytes[:], uint32(value))
+
+	_, err := writer.Write(intBytes[:])
+
+	return err
+}
+
+func writeString(writer io.Writer, str string) (err error) {
+	if err = writeBsorInt(writer, ReplayInt(len(str))); err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(writer, str)
+
+	return err
+}
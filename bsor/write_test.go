@@ -0,0 +1,273 @@
+package bsor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testReplay returns a replay with every part, including the optional ControllerOffsets and CustomData
+func testReplay(frames int) *Replay {
+	random := rand.New(rand.NewSource(int64(frames)))
+	noise := func() ReplayFloat { return random.Float32()*0.02 - 0.01 }
+
+	replay := &Replay{
+		Header: Header{Magic: bsorMagic, Version: BuiltinVersion},
+		Info: Info{
+			ModVersion:     "0.9.35",
+			GameVersion:    "1.34.2",
+			TimeSet:        time.Unix(1700000000, 0),
+			PlayerId:       "76561198059961776",
+			PlayerName:     "Zażółć gęślą jaźń",
+			Platform:       "steam",
+			TrackingSystem: "Oculus",
+			Hmd:            "Quest 2",
+			Controller:     "Touch",
+			Hash:           "ABCDEF0123456789ABCDEF0123456789ABCDEF01",
+			SongName:       "Song ♥",
+			Mapper:         "Mapper",
+			Difficulty:     "ExpertPlus",
+			Score:          1000000,
+			Mode:           "Standard",
+			Environment:    "Default",
+			Modifiers:      []Modifier{FasterSong, GhostNotes},
+			JumpDistance:   20,
+			Height:         1.75,
+			StartTime:      0.5,
+			Speed:          1,
+		},
+		Walls:   []WallHit{{LineIdx: 1, Width: 2, Energy: 0.4, Time: 10, SpawnTime: 9}},
+		Heights: []AutomaticHeight{{Height: 1.7, Time: 1}, {Height: 1.72, Time: 20}},
+		Pauses:  []Pause{{Duration: 5, Time: 12}},
+		ControllerOffsets: &ControllerOffsets{
+			LeftHand:  PositionAndRotation{Position: Position{X: 0.1, Y: -0.02}, Rotation: Rotation{Vector3: Vector3{Z: 0.1}, W: 0.99}},
+			RightHand: PositionAndRotation{Position: Position{X: -0.1}, Rotation: Rotation{W: 1}},
+		},
+		CustomData: []CustomData{{Key: "reesabers:settings", Value: []byte(`{"trail":1}`)}, {Key: "empty", Value: []byte{}}},
+	}
+
+	frameTime := TimeValue(0)
+	for i := 0; i < frames; i++ {
+		frameTime += 1.0 / 90
+		pose := func(x ReplayFloat) PositionAndRotation {
+			return PositionAndRotation{
+				Position: Position{X: x + ReplayFloat(math.Sin(float64(frameTime))), Y: 1.5 + noise(), Z: noise()},
+				Rotation: Rotation{Vector3: Vector3{X: noise(), Y: noise(), Z: noise()}, W: 0.99},
+			}
+		}
+
+		replay.Frames = append(replay.Frames, Frame{Time: frameTime, Fps: 90, Head: pose(0), LeftHand: pose(-0.3), RightHand: pose(0.3)})
+	}
+
+	for i := 0; i < frames/20; i++ {
+		note := Note{
+			ScoringType:  NoteScoringType(random.Intn(8)),
+			LineIdx:      LineValue(random.Intn(4)),
+			LineLayer:    LayerValue(random.Intn(3)),
+			ColorType:    ColorType(random.Intn(2)),
+			CutDirection: CutDirection(random.Intn(9)),
+			EventTime:    TimeValue(i) * 0.5,
+			SpawnTime:    TimeValue(i)*0.5 + 0.01,
+			EventType:    NoteEventType(random.Intn(4)),
+		}
+
+		if note.EventType == Good || note.EventType == Bad {
+			note.CutInfo = NoteCutInfo{
+				SpeedOk:             true,
+				DirectionOk:         note.EventType == Good,
+				SaberTypeOk:         true,
+				SaberSpeed:          5,
+				SaberType:           int32(note.ColorType),
+				BeforeCutRating:     random.Float32() + 0.3,
+				AfterCutRating:      random.Float32() + 0.2,
+				CutDistanceToCenter: random.Float32() * 0.3,
+				CutNormal:           Vector3{Z: noise()},
+			}
+		}
+
+		replay.Notes = append(replay.Notes, note)
+	}
+
+	return replay
+}
+
+func writeReplay(t testing.TB, replay *Replay) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	if err := Write(&buffer, replay); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	withoutOptionalParts := testReplay(300)
+	withoutOptionalParts.ControllerOffsets = nil
+	withoutOptionalParts.CustomData = nil
+
+	emptyCustomData := testReplay(300)
+	emptyCustomData.CustomData = []CustomData{}
+
+	// old replays store ids of bombs in the first line and layer as negative numbers
+	negativeIds := testReplay(300)
+	negativeIds.Notes[0] = Note{CutDirection: 255, EventTime: 1, SpawnTime: 1, EventType: Bomb}
+	negativeIds.Notes[1] = Note{ScoringType: 255, LineIdx: 254, LineLayer: 255, ColorType: 255, CutDirection: 248, EventTime: 2, SpawnTime: 2, EventType: Miss}
+	negativeIds.Walls[0] = WallHit{LineIdx: 255, ObstacleType: 254, Width: 255, Energy: 0.4, Time: 10, SpawnTime: 9}
+
+	// parts without elements are read as empty slices
+	noFrames := testReplay(0)
+	noFrames.Frames, noFrames.Notes = []Frame{}, []Note{}
+
+	tests := []struct {
+		name   string
+		replay *Replay
+	}{
+		{"all parts", testReplay(300)},
+		{"without optional parts", withoutOptionalParts},
+		{"empty custom data", emptyCustomData},
+		{"no frames", noFrames},
+		{"negative ids", negativeIds},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := writeReplay(t, test.replay)
+
+			replay, err := Read(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(replay, test.replay) {
+				t.Errorf("replay read back differs from the written one")
+			}
+
+			if written := writeReplay(t, replay); !bytes.Equal(written, data) {
+				t.Errorf("written again as %v bytes, first time %v bytes", len(written), len(data))
+			}
+		})
+	}
+}
+
+func TestWriteOptionalParts(t *testing.T) {
+	withoutOptionalParts := testReplay(10)
+	withoutOptionalParts.ControllerOffsets = nil
+	withoutOptionalParts.CustomData = nil
+
+	emptyCustomData := testReplay(10)
+	emptyCustomData.ControllerOffsets = nil
+	emptyCustomData.CustomData = []CustomData{}
+
+	tests := []struct {
+		name   string
+		replay *Replay
+		parts  []PartType
+	}{
+		{"all parts", testReplay(10), []PartType{InfoPart, FramesPart, NotesPart, WallsPart, HeightsPart, PausesPart, ControllerOffsetsPart, CustomDataPart}},
+		{"nil optional parts are not written", withoutOptionalParts, []PartType{InfoPart, FramesPart, NotesPart, WallsPart, HeightsPart, PausesPart}},
+		{"empty custom data is written", emptyCustomData, []PartType{InfoPart, FramesPart, NotesPart, WallsPart, HeightsPart, PausesPart, CustomDataPart}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			index, err := Index(bytes.NewReader(writeReplay(t, test.replay)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parts := make([]PartType, len(index.Parts))
+			for i, part := range index.Parts {
+				parts[i] = part.Type
+			}
+
+			if !reflect.DeepEqual(parts, test.parts) {
+				t.Errorf("written parts %v, want %v", parts, test.parts)
+			}
+		})
+	}
+}
+
+func TestWriteUnknownVersion(t *testing.T) {
+	replay := testReplay(10)
+	replay.Version = BuiltinVersion + 1
+
+	if err := Write(&bytes.Buffer{}, replay); !errors.Is(err, ErrUnknownBsorVersion) {
+		t.Errorf("got %v, want %v", err, ErrUnknownBsorVersion)
+	}
+}
+
+func TestWriteIds(t *testing.T) {
+	replay := testReplay(10)
+	replay.Notes = replay.Notes[:0]
+	replay.Notes = append(replay.Notes, Note{EventType: Miss})
+	data := writeReplay(t, replay)
+
+	index, err := Index(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notesOffset := index.Parts[NotesPart].Offset
+	wallsOffset := index.Parts[WallsPart].Offset
+
+	tests := []struct {
+		name   string
+		offset int64
+		id     ReplayInt
+		exact  bool
+	}{
+		{"bomb note", notesOffset, -1, true},
+		{"negative note", notesOffset, -1289999, true},
+		{"note", notesOffset, 30113, true},
+		{"largest note", notesOffset, 1279999, true},
+		{"note out of range", notesOffset, 1280000, false},
+		{"negative wall", wallsOffset, -12899, true},
+		{"wall", wallsOffset, 112, true},
+		{"largest wall", wallsOffset, 12799, true},
+		{"mapping extensions wall", wallsOffset, 30012, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := append([]byte{}, data...)
+			byteOrder.PutUint32(original[test.offset:], uint32(test.id))
+
+			replay, err := Read(bytes.NewReader(original))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if written := writeReplay(t, replay); bytes.Equal(written, original) != test.exact {
+				t.Errorf("id %v written back as %v", test.id, ReplayInt(byteOrder.Uint32(written[test.offset:])))
+			}
+		})
+	}
+}
+
+// replays loaded from JSON have no magic, it is not a part of the JSON form
+func TestWriteWithoutMagic(t *testing.T) {
+	data, err := json.Marshal(testReplay(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var replay Replay
+	if err = json.Unmarshal(data, &replay); err != nil {
+		t.Fatal(err)
+	}
+
+	if replay.Magic != 0 {
+		t.Fatalf("got magic %x in JSON", replay.Magic)
+	}
+
+	if _, err = Read(bytes.NewReader(writeReplay(t, &replay))); err != nil {
+		t.Error(err)
+	}
+}
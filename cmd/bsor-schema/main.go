@@ -0,0 +1,41 @@
+// Command bsor-schema writes JSON Schema documents of Replay, ReplayEvents and ReplayStats to the given directory.
+package main
+
+//go:generate go run . ../../schema
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/motzel/go-bsor/bsor"
+	"github.com/motzel/go-bsor/bsor/schema"
+)
+
+func main() {
+	dir := "."
+	if len(os.Args) > 1 {
+		dir = os.Args[1]
+	}
+
+	documents := []struct {
+		file  string
+		title string
+		value any
+	}{
+		{"replay.schema.json", "Replay", bsor.Replay{}},
+		{"replay-events.schema.json", "ReplayEvents", bsor.ReplayEvents{}},
+		{"replay-stats.schema.json", "ReplayStats", bsor.ReplayStats{}},
+	}
+
+	for _, document := range documents {
+		data, err := schema.Generate(document.value, document.title)
+		if err != nil {
+			log.Fatal("Can not generate schema: ", err)
+		}
+
+		if err = os.WriteFile(filepath.Join(dir, document.file), append(data, '\n'), 0644); err != nil {
+			log.Fatal("Can not write schema: ", err)
+		}
+	}
+}
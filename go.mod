@@ -1,3 +1,10 @@
 module github.com/motzel/go-bsor
 
 go 1.18
+
+require (
+	github.com/klauspost/compress v1.17.2
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+)
+
+require github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect